@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// modeSet is the -allowed-modes policy: the only modes a run may send, for
+// sites where some modes must never be used on a given radio. A nil set
+// allows every mode.
+type modeSet map[int]bool
+
+// parseAllowedModes parses -allowed-modes, a comma-separated list of mode
+// numbers such as 8,9,10,11. An empty list allows every mode.
+func parseAllowedModes(s string) (modeSet, error) {
+	items := splitList(s)
+	if len(items) == 0 {
+		return nil, nil
+	}
+	set := modeSet{}
+	for _, item := range items {
+		mode, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -allowed-modes entry %q: must be a mode number", item)
+		}
+		if err := ninotnc.ValidateMode(mode); err != nil {
+			return nil, fmt.Errorf("invalid -allowed-modes entry %q: %w", item, err)
+		}
+		set[mode] = true
+	}
+	return set, nil
+}
+
+// check returns an error if mode is outside the set.
+func (s modeSet) check(mode int) error {
+	if s == nil || s[mode] {
+		return nil
+	}
+	allowed := make([]string, 0, len(s))
+	for _, m := range slices.Sorted(maps.Keys(s)) {
+		allowed = append(allowed, strconv.Itoa(m))
+	}
+	return fmt.Errorf("mode %d is not allowed here: -allowed-modes permits only %s", mode, strings.Join(allowed, ", "))
+}
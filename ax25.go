@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// wrapAX25 carries a set-mode frame's command and mode bytes as the
+// information field of an AX.25 UI frame from src to dest, sent as a KISS
+// data frame on kissPort, for gateways that only forward data frames.
+func wrapAX25(frame []byte, dest, src string, kissPort int) ([]byte, error) {
+	d, err := ninotnc.ParseAddress(dest)
+	if err != nil {
+		return nil, err
+	}
+	s, err := ninotnc.ParseAddress(src)
+	if err != nil {
+		return nil, err
+	}
+	cmd := ninotnc.DecodeFrames(frame)[0]
+	ui, err := ninotnc.BuildUIFrame(d, s, append([]byte{cmd.Cmd}, cmd.Payload...))
+	if err != nil {
+		return nil, err
+	}
+	return ninotnc.BuildKISSFrameCmd(byte(kissPort<<4)|ninotnc.KISS_CMD_DATA, ui), nil
+}
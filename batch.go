@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// readLines delivers the lines of r on the returned channel, reading in the
+// background so callers can stop waiting when ctx is canceled. The channel is
+// closed at EOF, after which the error channel yields the read error, if any.
+func readLines(ctx context.Context, r io.Reader) (<-chan string, <-chan error) {
+	lines := make(chan string)
+	readErr := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- scanner.Err()
+	}()
+	return lines, readErr
+}
+
+// runBatch reads modes one per line from r and sends each over conn, pausing
+// delay between commands. Blank lines and lines starting with # are skipped.
+// It returns how many mode changes succeeded out of how many were attempted.
+func runBatch(ctx context.Context, conn ninotnc.KISSConnection, r io.Reader, cfg sendConfig, delay time.Duration) (ok, total int) {
+	lines, readErr := readLines(ctx, r)
+	lineNo := 0
+	for {
+		var line string
+		select {
+		case <-ctx.Done():
+			return ok, total
+		case l, more := <-lines:
+			if !more {
+				if err := <-readErr; err != nil {
+					logger.Errorf("Error reading stdin: %v", err)
+				}
+				return ok, total
+			}
+			line = l
+		}
+		lineNo++
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if total > 0 {
+			select {
+			case <-ctx.Done():
+				return ok, total
+			case <-time.After(delay):
+			}
+		}
+		total++
+		mode, err := parseBatchMode(line, cfg.allowed)
+		if err != nil {
+			logger.Errorf("Line %d: %v", lineNo, err)
+			continue
+		}
+		if _, err := sendMode(ctx, conn, mode, cfg); err != nil {
+			logger.Errorf("Line %d: %v", lineNo, err)
+			continue
+		}
+		ok++
+	}
+}
+
+// parseBatchMode parses one non-blank, non-comment line of batch input.
+func parseBatchMode(line string, allowed modeSet) (int, error) {
+	mode, err := strconv.Atoi(line)
+	if err != nil {
+		return 0, fmt.Errorf("invalid mode %q", line)
+	}
+	if err := ninotnc.ValidateMode(mode); err != nil {
+		return 0, err
+	}
+	if err := allowed.check(mode); err != nil {
+		return 0, err
+	}
+	return mode, nil
+}
+
+// checkBatch reads all of r and checks every line before anything is sent,
+// so a typo near the end of a batch does not leave the TNC half way through
+// it. It returns one message per invalid line and the input to replay into
+// runBatch, with the invalid lines blanked so that they are skipped there
+// and the line numbers in its messages still match.
+func checkBatch(r io.Reader, allowed modeSet) (string, []string, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return "", nil, err
+	}
+	lines := strings.Split(string(b), "\n")
+	var problems []string
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := parseBatchMode(line, allowed); err != nil {
+			problems = append(problems, fmt.Sprintf("line %d: %v", i+1, err))
+			lines[i] = ""
+		}
+	}
+	return strings.Join(lines, "\n"), problems, nil
+}
+
+// checkInput reports every problem found in batch or schedule input at once.
+// Unless force is set any problem stops the run before anything is sent;
+// with force they are logged as warnings and the invalid items skipped.
+func checkInput(what string, problems []string, force bool) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	if force {
+		for _, p := range problems {
+			logger.Warnf("Skipping %s", p)
+		}
+		return nil
+	}
+	for _, p := range problems {
+		logger.Errorf("%s", p)
+	}
+	entries := "entries"
+	if len(problems) == 1 {
+		entries = "entry"
+	}
+	return usageErrorf("%d invalid %s in %s; nothing sent (pass -force to send the valid ones anyway)", len(problems), entries, what)
+}
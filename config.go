@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// modeFlags are the flags that each select the mode; giving any of them
+// stops the others being taken from a config file.
+var modeFlags = []string{"mode", "dip", "mode-name", "mode-raw", "baud", "mod", "proto"}
+
+// configValue is one key = value line of a config file.
+type configValue struct {
+	key   string
+	value string
+	line  int
+}
+
+// config is a parsed config file: keys before the first [section] apply to
+// every profile, each [section] is a named profile, and each
+// [preset.name] section is a preset.
+type config struct {
+	global   []configValue
+	profiles map[string][]configValue
+	presets  map[string][]configValue
+}
+
+// presetPrefix starts the section header of a preset: a profile that gives
+// the whole connection and mode, so -preset on its own sets the mode.
+const presetPrefix = "preset."
+
+// defaultConfigPath is where -profile looks when -config is not given.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ninotnc", "setmode.toml")
+}
+
+// parseConfig reads the small TOML subset used for config files: comments
+// starting with #, [profile] section headers, and key = value lines whose
+// keys are flag names. Values may be bare or quoted.
+func parseConfig(r io.Reader) (*config, error) {
+	cfg := &config{profiles: map[string][]configValue{}, presets: map[string][]configValue{}}
+	section := ""
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: malformed section header %q", lineNo, line)
+			}
+			section = strings.Trim(strings.TrimSpace(line[1:len(line)-1]), `"`)
+			if section == "" {
+				return nil, fmt.Errorf("line %d: empty profile name", lineNo)
+			}
+			if name, ok := strings.CutPrefix(section, presetPrefix); ok {
+				if name == "" {
+					return nil, fmt.Errorf("line %d: empty preset name", lineNo)
+				}
+				if _, dup := cfg.preset(name); dup {
+					return nil, fmt.Errorf("line %d: preset %q defined twice", lineNo, name)
+				}
+				cfg.presets[name] = nil
+				continue
+			}
+			if _, dup := cfg.profiles[section]; dup {
+				return nil, fmt.Errorf("line %d: profile %q defined twice", lineNo, section)
+			}
+			cfg.profiles[section] = nil
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", lineNo, line)
+		}
+		key = strings.ReplaceAll(strings.TrimSpace(key), "_", "-")
+		value, err := configString(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		v := configValue{key: key, value: value, line: lineNo}
+		if name, ok := strings.CutPrefix(section, presetPrefix); ok {
+			name, _ = cfg.preset(name)
+			cfg.presets[name] = append(cfg.presets[name], v)
+		} else if section == "" {
+			cfg.global = append(cfg.global, v)
+		} else {
+			cfg.profiles[section] = append(cfg.profiles[section], v)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// configString strips the quotes from a quoted value, and any trailing
+// comment from a bare one.
+func configString(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		for i := 1; i < len(value); i++ {
+			switch value[i] {
+			case '\\':
+				i++
+			case '"':
+				return strconv.Unquote(value[:i+1])
+			}
+		}
+		return "", fmt.Errorf("unterminated string %s", value)
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string %s", value)
+		}
+		return value[1 : end+1], nil
+	}
+	if i := strings.Index(value, "#"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+// preset returns the name a preset is defined under, matching name ignoring
+// case since presets are typed by hand, and whether it is defined.
+func (c *config) preset(name string) (string, bool) {
+	for defined := range c.presets {
+		if strings.EqualFold(defined, name) {
+			return defined, true
+		}
+	}
+	return name, false
+}
+
+// sortedNames returns the keys of sections in order, for error messages.
+func sortedNames(sections map[string][]configValue) string {
+	names := make([]string, 0, len(sections))
+	for name := range sections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// applyConfig sets each flag in fs that was not given on the command line or
+// through the environment from the named profile or preset, then from the
+// keys shared by all profiles. With neither, only the shared keys apply. A
+// preset must select a mode, as running it is meant to set one.
+func applyConfig(fs *flag.FlagSet, cfg *config, profile, preset string) error {
+	values := cfg.global
+	if profile != "" {
+		pv, ok := cfg.profiles[profile]
+		if !ok {
+			return fmt.Errorf("unknown profile %q, the config file defines: %s", profile, sortedNames(cfg.profiles))
+		}
+		values = append(append([]configValue(nil), pv...), values...)
+	}
+	if preset != "" {
+		name, ok := cfg.preset(preset)
+		if !ok {
+			return fmt.Errorf("unknown preset %q, the config file defines: %s", preset, sortedNames(cfg.presets))
+		}
+		pv := cfg.presets[name]
+		if !slices.ContainsFunc(pv, func(v configValue) bool { return slices.Contains(modeFlags, v.key) }) {
+			return fmt.Errorf("preset %q does not select a mode: give it one of %s", name, strings.Join(modeFlags, ", "))
+		}
+		values = append(append([]configValue(nil), pv...), values...)
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	modeSet := false
+	for _, name := range modeFlags {
+		modeSet = modeSet || set[name]
+	}
+	for _, v := range values {
+		if v.key == "config" || v.key == "profile" || v.key == "preset" || fs.Lookup(v.key) == nil {
+			return fmt.Errorf("line %d: unknown setting %q", v.line, v.key)
+		}
+		if set[v.key] {
+			continue
+		}
+		isMode := false
+		for _, name := range modeFlags {
+			isMode = isMode || v.key == name
+		}
+		if isMode && modeSet {
+			continue
+		}
+		if err := fs.Set(v.key, v.value); err != nil {
+			return fmt.Errorf("line %d: invalid %s %q: %v", v.line, v.key, v.value, err)
+		}
+		set[v.key] = true
+		modeSet = modeSet || isMode
+	}
+	return nil
+}
+
+// loadConfig applies the config file named by -config, or the default file
+// when only -profile or -preset is given, to fs.
+func loadConfig(fs *flag.FlagSet, path, profile, preset string) error {
+	if profile != "" && preset != "" {
+		return fmt.Errorf("the -profile and -preset flags are mutually exclusive")
+	}
+	if path == "" {
+		if profile == "" && preset == "" {
+			return nil
+		}
+		path = defaultConfigPath()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error reading config: %w", err)
+	}
+	defer f.Close()
+	cfg, err := parseConfig(f)
+	if err != nil {
+		return fmt.Errorf("error reading config %s: %w", path, err)
+	}
+	if err := applyConfig(fs, cfg, profile, preset); err != nil {
+		return fmt.Errorf("error in config %s: %w", path, err)
+	}
+	return nil
+}
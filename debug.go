@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// debugConn logs a hex dump of every frame written to or read from the
+// wrapped connection, and checks outgoing frames are well formed. A write
+// may hold several frames back to back, as -commands sends them, and each
+// is checked on its own.
+type debugConn struct {
+	ninotnc.KISSConnection
+}
+
+func (d debugConn) Write(b []byte) (int, error) {
+	logger.Debugf("TX %d bytes:\n%s", len(b), hex.Dump(b))
+	if err := ninotnc.ValidateFrames(b); err != nil {
+		logger.Warnf("TX frame is malformed: %v", err)
+	}
+	return d.KISSConnection.Write(b)
+}
+
+func (d debugConn) ReadFrame(timeout time.Duration) ([]byte, error) {
+	frame, err := d.KISSConnection.ReadFrame(timeout)
+	if err == nil {
+		logger.Debugf("RX frame, %d bytes un-escaped:\n%s", len(frame), hex.Dump(frame))
+	}
+	return frame, err
+}
+
+// Drain passes through to connections that buffer output.
+func (d debugConn) Drain() error {
+	if dr, ok := d.KISSConnection.(interface{ Drain() error }); ok {
+		return dr.Drain()
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+	"github.com/madpsy/ninotnc-set-mode/ninotnc/kisstest"
+)
+
+// captureLog sends logger output, at every level, to the returned buffer
+// until the test ends.
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	saved := logger
+	logger = ninotnc.StdLogger{Logger: log.New(&buf, "", 0), Level: ninotnc.LevelDebug}
+	t.Cleanup(func() { logger = saved })
+	return &buf
+}
+
+func TestDebugConnMultiFrameWrite(t *testing.T) {
+	buf := captureLog(t)
+	conn := kisstest.New()
+	d := debugConn{conn}
+	b := ninotnc.BuildKISSFrames([]ninotnc.Command{{Cmd: 0x06, Payload: []byte{0x03}}, {Cmd: 0x0A, Payload: []byte{0x01}}})
+	if _, err := d.Write(b); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if strings.Contains(buf.String(), "malformed") {
+		t.Errorf("two well-formed frames logged as malformed:\n%s", buf)
+	}
+	if got := conn.Frames(); len(got) != 1 || !bytes.Equal(got[0], b) {
+		t.Errorf("wrapped connection got % X, want the write passed through unchanged", got)
+	}
+}
+
+func TestDebugConnMalformedWrite(t *testing.T) {
+	buf := captureLog(t)
+	d := debugConn{kisstest.New()}
+	b := append(ninotnc.BuildKISSFrameCmd(0x06, []byte{0x03}), 0xC0, 0x0A, 0xDB, 0x41, 0xC0)
+	if _, err := d.Write(b); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if !strings.Contains(buf.String(), "TX frame is malformed: frame 2") {
+		t.Errorf("bad second frame not reported:\n%s", buf)
+	}
+}
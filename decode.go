@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// decodeFile prints each KISS frame in the file at path, a raw byte capture
+// of a TNC session, one line per frame: its offset, KISS port, command and
+// payload, and for set-mode frames the mode it selects.
+func decodeFile(w io.Writer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading capture: %w", err)
+	}
+	frames := ninotnc.DecodeFrames(data)
+	for _, f := range frames {
+		fmt.Fprintf(w, "%08X port %d %s\n", f.Offset, f.Cmd>>4, describeFrame(f))
+	}
+	if len(frames) == 0 {
+		return fmt.Errorf("no KISS frames found in %s", path)
+	}
+	return nil
+}
+
+func describeFrame(f ninotnc.DecodedFrame) string {
+	var s string
+	switch cmd := f.Cmd & 0x0F; {
+	case cmd == ninotnc.KISS_CMD_DATA:
+		s = fmt.Sprintf("data, %d bytes: % X", len(f.Payload), f.Payload)
+	case cmd == ninotnc.KISS_CMD_SETHW && len(f.Payload) == 1:
+		s = "set mode " + describeModeByte(f.Payload[0])
+	case len(f.Payload) == 0:
+		s = fmt.Sprintf("command %02X", cmd)
+	default:
+		s = fmt.Sprintf("command %02X: % X", cmd, f.Payload)
+	}
+	if f.Err != nil {
+		s += fmt.Sprintf(" (%v)", f.Err)
+	}
+	return s
+}
+
+// describeModeByte explains a set-mode byte: the mode in the low nibble,
+// stored in TNC memory unless the non-persistent offset of 16 is added.
+func describeModeByte(b byte) string {
+	mode := int(b & 0x0F)
+	s := fmt.Sprintf("%d", mode)
+	if m, ok := ninotnc.LookupMode(mode); ok {
+		s += " (" + m.Name() + ")"
+	}
+	switch {
+	case b < 16:
+		return s + ", stored"
+	case b < 32:
+		return s + ", until power off"
+	default:
+		return fmt.Sprintf("byte %02X, outside the mode range", b)
+	}
+}
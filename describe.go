@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"runtime"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// describeSchemaVersion is the version of the -describe document. Fields
+// may be added without changing it; it goes up when one is removed, renamed
+// or changes meaning, so a front-end can refuse a document it does not
+// understand.
+const describeSchemaVersion = 1
+
+// description is the document printed by -describe, for front-ends that
+// build their interface from it instead of hard-coding this tool's flags.
+type description struct {
+	SchemaVersion int                `json:"schema_version"`
+	Version       describeVersion    `json:"version"`
+	Connections   []string           `json:"connection_types"`
+	Flags         []describeFlag     `json:"flags"`
+	Modes         []ninotnc.ModeInfo `json:"modes"`
+	ExitCodes     map[string]int     `json:"exit_codes"`
+}
+
+type describeVersion struct {
+	Version     string `json:"version"`
+	Revision    string `json:"revision,omitempty"`
+	Date        string `json:"date,omitempty"`
+	Modified    bool   `json:"modified,omitempty"`
+	Go          string `json:"go"`
+	Platform    string `json:"platform"`
+	MinFirmware int    `json:"min_firmware"`
+}
+
+// describeFlag is one command-line flag. Type is bool, int, uint, float,
+// duration or string; Default is the default as -help prints it.
+type describeFlag struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Default string `json:"default"`
+	Usage   string `json:"usage"`
+	Env     string `json:"env,omitempty"`
+}
+
+// flagType names the kind of value f takes.
+func flagType(f *flag.Flag) string {
+	g, ok := f.Value.(flag.Getter)
+	if !ok {
+		return "string"
+	}
+	switch g.Get().(type) {
+	case bool:
+		return "bool"
+	case int, int64:
+		return "int"
+	case uint, uint64:
+		return "uint"
+	case float64:
+		return "float"
+	case time.Duration:
+		return "duration"
+	}
+	return "string"
+}
+
+// printDescription writes the -describe document for the flags in fs as
+// indented JSON.
+func printDescription(w io.Writer, fs *flag.FlagSet) error {
+	ver, revision, date, dirty := buildInfo()
+	d := description{
+		SchemaVersion: describeSchemaVersion,
+		Version: describeVersion{
+			Version:     ver,
+			Revision:    revision,
+			Date:        date,
+			Modified:    dirty,
+			Go:          runtime.Version(),
+			Platform:    runtime.GOOS + "/" + runtime.GOARCH,
+			MinFirmware: ninotnc.MinFirmwareVersion,
+		},
+		Connections: []string{"tcp", "udp", "agw", "serial"},
+		Modes:       ninotnc.Modes(),
+		ExitCodes: map[string]int{
+			"ok":              exitOK,
+			"failure":         exitFailure,
+			"usage":           exitUsage,
+			"connect":         exitConnect,
+			"write":           exitWrite,
+			"timeout":         exitTimeout,
+			"verify":          exitVerify,
+			"refused":         exitRefused,
+			"unreachable":     exitUnreachable,
+			"dns":             exitDNS,
+			"connect_timeout": exitConnectTimeout,
+			"interrupted":     exitInterrupted,
+		},
+	}
+	// PTY connections exist only on Linux.
+	if runtime.GOOS == "linux" {
+		d.Connections = append(d.Connections, "pty")
+	}
+	env := map[string]string{}
+	for _, ef := range envFlags {
+		env[ef.flag] = ef.env
+	}
+	fs.VisitAll(func(f *flag.Flag) {
+		// UnquoteUsage drops the backquotes that name a flag's value in -help.
+		_, usage := flag.UnquoteUsage(f)
+		d.Flags = append(d.Flags, describeFlag{Name: f.Name, Type: flagType(f), Default: f.DefValue, Usage: usage, Env: env[f.Name]})
+	})
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// dialFailure classifies why connecting to a network TNC failed, giving an
+// exit code that tells a service that is down from a host that cannot be
+// reached or a name that does not resolve, and a hint on what to check. ok
+// is false for any other error.
+func dialFailure(err error) (code int, hint string, ok bool) {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &dnsErr):
+		return exitDNS, "check the host name", true
+	case !errors.As(err, &opErr):
+		return 0, "", false
+	case isErrno(err, refusedErrnos):
+		return exitRefused, "nothing is listening on that port; is the KISS server running?", true
+	case isErrno(err, unreachableErrnos):
+		return exitUnreachable, "check the host is up and there is a route to it", true
+	case opErr.Timeout():
+		return exitConnectTimeout, "check the host and port, and any firewall in between", true
+	}
+	return 0, "", false
+}
+
+func isErrno(err error, errnos []error) bool {
+	for _, e := range errnos {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+// explainDial adds dialFailure's hint to a failed network connection.
+func explainDial(err error) error {
+	if _, hint, ok := dialFailure(err); ok {
+		return fmt.Errorf("%w (%s)", err, hint)
+	}
+	return err
+}
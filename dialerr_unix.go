@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+var (
+	refusedErrnos     = []error{syscall.ECONNREFUSED}
+	unreachableErrnos = []error{syscall.EHOSTUNREACH, syscall.ENETUNREACH}
+)
@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// Winsock reports these as its own error numbers, which the syscall
+// package has no names for.
+var (
+	refusedErrnos     = []error{syscall.Errno(10061)}                       // WSAECONNREFUSED
+	unreachableErrnos = []error{syscall.Errno(10065), syscall.Errno(10051)} // WSAEHOSTUNREACH, WSAENETUNREACH
+)
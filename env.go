@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"os"
+)
+
+// envFlags maps flags to the environment variables that supply their value
+// when the flag is not given. Precedence is command-line flag, then
+// environment variable, then config file, then the flag's built-in default.
+var envFlags = []struct {
+	flag string
+	env  string
+	// alternatives are flags that, when given, replace this one, so the
+	// environment variable must not be applied alongside them.
+	alternatives []string
+}{
+	{"connection", "NINOTNC_CONNECTION", nil},
+	{"host", "NINOTNC_HOST", nil},
+	{"port", "NINOTNC_PORT", nil},
+	{"serial-port", "NINOTNC_SERIAL_PORT", nil},
+	{"serial-baud", "NINOTNC_SERIAL_BAUD", nil},
+	{"mode", "NINOTNC_MODE", []string{"dip", "mode-name", "mode-raw", "baud", "mod", "proto"}},
+	{"config", "NINOTNC_CONFIG", nil},
+	{"profile", "NINOTNC_PROFILE", nil},
+}
+
+// applyEnv sets each flag in fs that was not given on the command line from
+// its environment variable, if that is set.
+func applyEnv(fs *flag.FlagSet, lookupEnv func(string) (string, bool)) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+loop:
+	for _, ef := range envFlags {
+		if set[ef.flag] {
+			continue
+		}
+		for _, alt := range ef.alternatives {
+			if set[alt] {
+				continue loop
+			}
+		}
+		value, ok := lookupEnv(ef.env)
+		if !ok || value == "" {
+			continue
+		}
+		if err := fs.Set(ef.flag, value); err != nil {
+			return usageErrorf("invalid %s=%q: %v", ef.env, value, err)
+		}
+	}
+	return nil
+}
+
+// envConfigured reports whether any of the environment variables in envFlags
+// is set.
+func envConfigured() bool {
+	for _, ef := range envFlags {
+		if os.Getenv(ef.env) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"strings"
+	"testing"
+)
+
+// parseLayers parses args into a fresh flag set, then applies env and the
+// config text in the order main does, and returns the resulting options.
+func parseLayers(t *testing.T, args []string, env map[string]string, configText string) (*options, error) {
+	t.Helper()
+	var o options
+	fs := flag.NewFlagSet("setmode", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	o.register(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Parse(%q): %v", args, err)
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	if err := applyEnv(fs, lookup); err != nil {
+		return nil, err
+	}
+	cfg, err := parseConfig(strings.NewReader(configText))
+	if err != nil {
+		t.Fatalf("parseConfig: %v", err)
+	}
+	if err := applyConfig(fs, cfg, "", ""); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func TestSettingPrecedence(t *testing.T) {
+	const configText = "port = 7000\nhost = \"config.example\"\n"
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		config   string
+		wantPort int
+		wantHost string
+	}{
+		{"default", nil, nil, "", 5001, "127.0.0.1"},
+		{"config over default", nil, nil, configText, 7000, "config.example"},
+		{"env over config", nil, map[string]string{"NINOTNC_PORT": "6000"}, configText, 6000, "config.example"},
+		{"flag over env", []string{"-port", "8001"}, map[string]string{"NINOTNC_PORT": "6000"}, configText, 8001, "config.example"},
+		{"empty env is ignored", nil, map[string]string{"NINOTNC_PORT": ""}, configText, 7000, "config.example"},
+		{"each flag independently", []string{"-host", "flag.example"}, map[string]string{"NINOTNC_PORT": "6000"}, configText, 6000, "flag.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o, err := parseLayers(t, tt.args, tt.env, tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if o.port != tt.wantPort || o.host != tt.wantHost {
+				t.Errorf("port, host = %d, %q, want %d, %q", o.port, o.host, tt.wantPort, tt.wantHost)
+			}
+		})
+	}
+}
+
+// TestEnvModeAlternatives checks NINOTNC_MODE is not applied when the mode
+// is chosen another way on the command line.
+func TestEnvModeAlternatives(t *testing.T) {
+	o, err := parseLayers(t, []string{"-mode-name", "GFSK 9600"}, map[string]string{"NINOTNC_MODE": "3"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o.mode != 0 {
+		t.Errorf("mode = %d, want NINOTNC_MODE ignored alongside -mode-name", o.mode)
+	}
+}
+
+func TestEnvMalformed(t *testing.T) {
+	_, err := parseLayers(t, nil, map[string]string{"NINOTNC_PORT": "abc"}, "")
+	if err == nil {
+		t.Fatal("NINOTNC_PORT=abc was accepted")
+	}
+	if code := exitCode(err); code != exitUsage {
+		t.Errorf("exitCode = %d, want %d (usage)", code, exitUsage)
+	}
+	if !strings.Contains(err.Error(), "NINOTNC_PORT") {
+		t.Errorf("error %q does not name the variable", err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// Exit codes, so that monitoring can tell failure classes apart.
+const (
+	exitOK      = 0
+	exitFailure = 1 // anything not covered below, e.g. part of a batch failed
+	exitUsage   = 2 // invalid flags or mode
+	exitConnect = 3 // could not connect to the TNC
+	exitWrite   = 4 // could not send the command
+	exitTimeout = 5 // no acknowledgement or report within -timeout
+	exitVerify  = 6 // -verify could not confirm the mode was stored
+
+	// More specific reasons for exitConnect on a network connection.
+	exitRefused        = 7  // connection refused: the KISS server is not running
+	exitUnreachable    = 8  // no route to the host
+	exitDNS            = 9  // the host name did not resolve
+	exitConnectTimeout = 10 // the connection attempt timed out
+
+	// exitInterrupted follows the shell convention of 128 plus SIGINT's
+	// number, so a script can tell a canceled run from a successful one.
+	exitInterrupted = 130 // stopped by Ctrl-C or SIGTERM
+)
+
+// isConnectFailure reports whether code is exitConnect or one of its more
+// specific forms.
+func isConnectFailure(code int) bool {
+	switch code {
+	case exitConnect, exitRefused, exitUnreachable, exitDNS, exitConnectTimeout:
+		return true
+	}
+	return false
+}
+
+// exitError attaches an exit code to an error returned by run.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+func withCode(code int, err error) error {
+	return &exitError{code: code, err: err}
+}
+
+func usageErrorf(format string, args ...any) error {
+	return withCode(exitUsage, fmt.Errorf(format, args...))
+}
+
+// exitCode maps an error returned by run to the process exit status.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if errors.Is(err, context.Canceled) {
+		return exitInterrupted
+	}
+	var ee *exitError
+	if errors.As(err, &ee) {
+		if ee.code == exitConnect {
+			if code, _, ok := dialFailure(err); ok {
+				return code
+			}
+		}
+		return ee.code
+	}
+	// Errors the ninotnc package classifies map to the matching code even
+	// where run has not attached one.
+	switch {
+	case errors.Is(err, ninotnc.ErrInvalidMode):
+		return exitUsage
+	case errors.Is(err, ninotnc.ErrConnect):
+		if code, _, ok := dialFailure(err); ok {
+			return code
+		}
+		return exitConnect
+	case errors.Is(err, ninotnc.ErrWrite):
+		return exitWrite
+	case errors.Is(err, ninotnc.ErrTimeout):
+		return exitTimeout
+	}
+	return exitFailure
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// transport is one way of reaching a TNC: the connection flags to use and
+// the host or serial port to open.
+type transport struct {
+	o      options
+	device string
+}
+
+func (t transport) String() string {
+	return strings.ToLower(t.o.connectionType) + " " + target(&t.o, t.device)
+}
+
+// parseFallbacks parses -fallback, a comma-separated list of URLs such as
+// tcp://host:5001, udp://host:9001, agw://host:8000 or
+// serial:///dev/ttyACM0?baud=57600 (serial:COM3 on Windows). Settings not
+// in a URL are taken from base, except that the TLS, proxy and handshake
+// options only carry over to tcp entries and -wait-for-device and
+// -write-timeout to serial ones.
+func parseFallbacks(base *options, list string) ([]transport, error) {
+	var transports []transport
+	for _, s := range splitList(list) {
+		t, err := parseTransport(base, s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -fallback %q: %w", s, err)
+		}
+		transports = append(transports, t)
+	}
+	return transports, nil
+}
+
+func parseTransport(base *options, s string) (transport, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return transport{}, err
+	}
+	t := transport{o: *base}
+	t.o.connectionType = strings.ToLower(u.Scheme)
+	if t.o.connectionType != "tcp" {
+		t.o.tls, t.o.tlsInsecure, t.o.tlsCA = false, false, ""
+		t.o.proxy, t.o.handshake = "", ""
+	}
+	if t.o.connectionType != "serial" {
+		t.o.waitForDevice, t.o.writeTimeout = 0, 0
+	}
+	switch t.o.connectionType {
+	case "tcp", "udp", "agw":
+		t.device = u.Hostname()
+		if t.device == "" {
+			return transport{}, fmt.Errorf("no host given")
+		}
+		t.o.port = 5001
+		if t.o.connectionType == "agw" {
+			t.o.port = 8000
+		}
+		if p := u.Port(); p != "" {
+			if t.o.port, err = strconv.Atoi(p); err != nil {
+				return transport{}, fmt.Errorf("invalid port %q", p)
+			}
+		}
+	case "serial":
+		t.device = u.Path
+		if u.Opaque != "" {
+			t.device = u.Opaque
+		}
+		if t.device == "" {
+			return transport{}, fmt.Errorf("no serial port given")
+		}
+		t.o.serialPort = t.device
+		if b := u.Query().Get("baud"); b != "" {
+			if t.o.serialBaud, err = strconv.Atoi(b); err != nil {
+				return transport{}, fmt.Errorf("invalid baud %q", b)
+			}
+		}
+	default:
+		return transport{}, fmt.Errorf("unsupported transport %q: must be tcp, udp, agw or serial", u.Scheme)
+	}
+	if err := checkConnectionFlags(&t.o); err != nil {
+		return transport{}, err
+	}
+	return t, nil
+}
+
+// applyWithFallback tries each transport in turn until one connects and the
+// command is sent. Other failures, such as the TNC acknowledging the wrong
+// mode, would happen whichever way it was reached, so they are returned
+// without trying the rest.
+func applyWithFallback(ctx context.Context, transports []transport, connect func(*options, string) (ninotnc.KISSConnection, error), mode int, cfg sendConfig) (transport, ninotnc.SetModeResult, error) {
+	var t transport
+	var res ninotnc.SetModeResult
+	var err error
+	for i := range transports {
+		if i > 0 {
+			logger.Warnf("%v failed: %v; falling back to %v", t, err, transports[i])
+		}
+		t = transports[i]
+		res, err = applyMode(ctx, func() (ninotnc.KISSConnection, error) { return connect(&t.o, t.device) }, mode, cfg)
+		if code := exitCode(err); err == nil || ctx.Err() != nil || (!isConnectFailure(code) && code != exitWrite) {
+			break
+		}
+	}
+	if err == nil && len(transports) > 1 {
+		logger.Infof("Mode set via %v", t)
+	}
+	return t, res, err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// runControlFIFO applies modes written to the FIFO at path over conn, one
+// per line and checked as -stdin lines are, until ctx is canceled. The FIFO
+// is opened for writing as well as reading, so opening it does not wait for
+// a writer and a writer closing it is not end of input: each "echo 3 > fifo"
+// just adds a line.
+func runControlFIFO(ctx context.Context, conn ninotnc.KISSConnection, path string, cfg sendConfig, delay time.Duration) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("error opening control FIFO: %w", err)
+	}
+	defer f.Close()
+	logger.Infof("Reading modes from %s; stop with Ctrl-C or SIGTERM", path)
+	ok, total := runBatch(ctx, conn, f, cfg, delay)
+	logger.Infof("Control FIFO stopped: %d of %d mode changes succeeded", ok, total)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return fmt.Errorf("stopped reading %s", path)
+}
+
+// checkControlFIFO checks path is an existing named pipe.
+func checkControlFIFO(path string) error {
+	if runtime.GOOS == "windows" {
+		return fmt.Errorf("the -control-fifo flag is not supported on Windows")
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("invalid -control-fifo: %w", err)
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("invalid -control-fifo %s: not a FIFO; create one with mkfifo", path)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// modeFilter narrows -list and -list-json to the modes matching every field
+// set: usage (FM or SSB, so SSB/FM modes match either), bandwidth and
+// protocol.
+type modeFilter struct {
+	usage, bandwidth, protocol string
+}
+
+func normProtocol(p string) string { return strings.ToLower(strings.ReplaceAll(p, ".", "")) }
+
+// modeUsages splits a mode's Usage, such as SSB/FM, into the channel types
+// it can be used on.
+func modeUsages(m ninotnc.ModeInfo) []string { return strings.Split(m.Usage, "/") }
+
+// parseModeFilter builds the filter from -usage, -bandwidth and -proto,
+// checking each value against those the mode table uses, ignoring case.
+func parseModeFilter(usage, bandwidth, protocol string) (modeFilter, error) {
+	var usages, bandwidths, protocols []string
+	for _, m := range ninotnc.Modes() {
+		for _, u := range modeUsages(m) {
+			if !slices.Contains(usages, u) {
+				usages = append(usages, u)
+			}
+		}
+		if !slices.Contains(bandwidths, m.Bandwidth) {
+			bandwidths = append(bandwidths, m.Bandwidth)
+		}
+		if !slices.Contains(protocols, m.Protocol) {
+			protocols = append(protocols, m.Protocol)
+		}
+	}
+	for _, c := range []struct {
+		flag, value string
+		valid       []string
+		norm        func(string) string
+	}{
+		{"usage", usage, usages, strings.ToLower},
+		{"bandwidth", bandwidth, bandwidths, strings.ToLower},
+		{"proto", protocol, protocols, normProtocol},
+	} {
+		if c.value != "" && !slices.ContainsFunc(c.valid, func(v string) bool { return c.norm(v) == c.norm(c.value) }) {
+			return modeFilter{}, fmt.Errorf("invalid -%s %q: must be one of %s", c.flag, c.value, strings.Join(c.valid, ", "))
+		}
+	}
+	return modeFilter{usage: usage, bandwidth: bandwidth, protocol: protocol}, nil
+}
+
+func (f modeFilter) match(m ninotnc.ModeInfo) bool {
+	if f.usage != "" && !slices.ContainsFunc(modeUsages(m), func(u string) bool { return strings.EqualFold(u, f.usage) }) {
+		return false
+	}
+	if f.bandwidth != "" && !strings.EqualFold(m.Bandwidth, f.bandwidth) {
+		return false
+	}
+	return f.protocol == "" || normProtocol(m.Protocol) == normProtocol(f.protocol)
+}
+
+// modes returns the table entries f matches, in table order.
+func (f modeFilter) modes() []ninotnc.ModeInfo {
+	var matched []ninotnc.ModeInfo
+	for _, m := range ninotnc.Modes() {
+		if f.match(m) {
+			matched = append(matched, m)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// hookEvent describes a finished mode change for -on-success and
+// -on-failure.
+type hookEvent struct {
+	connection string
+	target     string
+	label      string
+	mode       int
+	write      bool
+	result     ninotnc.SetModeResult
+	err        error
+}
+
+// env returns the SETMODE_* variables a hook command is run with. They are
+// not NINOTNC_* so that a hook that runs setmode again does not take them as
+// flag values.
+func (e hookEvent) env() []string {
+	status := "success"
+	if e.err != nil {
+		status = "failure"
+	}
+	m, _ := ninotnc.LookupMode(e.mode)
+	vars := []string{
+		"SETMODE_RESULT=" + status,
+		"SETMODE_MODE=" + strconv.Itoa(e.mode),
+		"SETMODE_MODE_NAME=" + m.Name(),
+		"SETMODE_WRITE=" + strconv.FormatBool(e.write),
+		"SETMODE_CONNECTION=" + e.connection,
+		"SETMODE_DEVICE=" + e.target,
+		"SETMODE_LABEL=" + e.label,
+		"SETMODE_TIME=" + time.Now().Format(time.RFC3339),
+	}
+	if e.result.Acknowledged() {
+		vars = append(vars, "SETMODE_EFFECTIVE_MODE="+strconv.Itoa(e.result.EffectiveMode))
+	}
+	if e.err != nil {
+		vars = append(vars, "SETMODE_ERROR="+e.err.Error())
+	}
+	return vars
+}
+
+// runHook runs command through the shell with e's variables added to the
+// environment, logging each line it prints. A hook that fails is only
+// warned about: the mode change has already happened, or not, either way.
+func runHook(ctx context.Context, command string, e hookEvent) {
+	if command == "" {
+		return
+	}
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), e.env()...)
+	out, err := cmd.CombinedOutput()
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		logger.Infof("Hook: %s", scanner.Text())
+	}
+	if err != nil {
+		logger.Warnf("Hook %q failed: %v", strings.TrimSpace(command), err)
+	}
+}
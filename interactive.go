@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+const interactiveHelp = `Commands:
+  <mode>    set a mode by number, e.g. 3, or by name, e.g. 9600-4fsk
+  list      print the mode table
+  help      print this help
+  quit      close the connection and exit (also exit or EOF)
+`
+
+// runInteractive reads commands from in and sends each mode over conn,
+// printing the outcome to out, until EOF, quit or ctx is canceled.
+func runInteractive(ctx context.Context, conn ninotnc.KISSConnection, in io.Reader, out io.Writer, cfg sendConfig) error {
+	lines, readErr := readLines(ctx, in)
+	fmt.Fprint(out, "Type a mode number or name, list, help or quit.\n")
+	for {
+		fmt.Fprint(out, "setmode> ")
+		var line string
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(out)
+			return ctx.Err()
+		case l, more := <-lines:
+			if !more {
+				fmt.Fprintln(out)
+				return <-readErr
+			}
+			line = strings.TrimSpace(l)
+		}
+
+		switch strings.ToLower(line) {
+		case "":
+			continue
+		case "quit", "exit":
+			return nil
+		case "list":
+			printModeTable(out, ninotnc.Modes(), tableColors{})
+			continue
+		case "help", "?":
+			fmt.Fprint(out, interactiveHelp)
+			continue
+		}
+
+		mode, err := strconv.Atoi(line)
+		if err != nil {
+			m, err := ninotnc.LookupModeName(line)
+			if err != nil {
+				fmt.Fprintln(out, err)
+				continue
+			}
+			mode = m.Mode
+		}
+		res, err := sendMode(ctx, conn, mode, cfg)
+		switch {
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case err != nil:
+			fmt.Fprintf(out, "FAILED: %v\n", err)
+		case res.Acknowledged():
+			fmt.Fprintf(out, "OK: %s, response % X\n", describeResult(res), res.Response)
+		default:
+			fmt.Fprintf(out, "Sent mode %d, no acknowledgement\n", mode)
+		}
+	}
+}
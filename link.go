@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// linkCheck is the -verify-link setting: after the mode is set, transmit an
+// AX.25 UI frame from call to itself and wait up to timeout to hear it back.
+type linkCheck struct {
+	call    ninotnc.Address
+	timeout time.Duration
+}
+
+// verifyLink sends, over conn once the mode is set, a UI frame carrying a
+// token unique to this run as a KISS data frame on the command's port, and
+// waits for a received data frame that carries the same token. A TNC does
+// not hear its own transmissions, so this only passes when something sends
+// the frame back: a second TNC or digipeater in range, an RF loopback, or a
+// TNC that reports what it sends as received. Frames that do not match,
+// such as other stations' traffic, are skipped.
+func verifyLink(ctx context.Context, conn ninotnc.KISSConnection, check linkCheck, kissPort int) error {
+	token := fmt.Appendf(nil, "setmode link check %08x", uint32(time.Now().UnixNano()))
+	ui, err := ninotnc.BuildUIFrame(check.call, check.call, token)
+	if err != nil {
+		return withCode(exitUsage, err)
+	}
+	dataCmd := byte(kissPort<<4) | ninotnc.KISS_CMD_DATA
+	if _, err := conn.Write(ninotnc.BuildKISSFrameCmd(dataCmd, ui)); err != nil {
+		return withCode(exitWrite, fmt.Errorf("error sending the link check frame: %w", explainWrite(err)))
+	}
+	logger.Infof("Sent link check frame from %v, waiting up to %v to hear it back", check.call, check.timeout)
+	sent := time.Now()
+	deadline := sent.Add(check.timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return withCode(exitVerify, fmt.Errorf("link check failed: the frame was not heard back within %v", check.timeout))
+		}
+		frame, err := readFrameContext(ctx, conn, remaining)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, ninotnc.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			return withCode(exitVerify, fmt.Errorf("error reading while checking the link: %w", err))
+		}
+		if len(frame) > 0 && frame[0] == dataCmd && bytes.Contains(frame[1:], token) {
+			logger.Infof("Link check passed: frame heard back in %.1fms", millis(time.Since(sent)))
+			return nil
+		}
+		logger.Debugf("Link check: skipping unrelated frame % X", frame)
+	}
+}
+
+// parseLinkCheck returns the -verify-link setting, or nil without it. The
+// check follows a single mode change, so it is refused with the batch,
+// interactive and raw command modes, and with -reopen-baud, which
+// changes the host link rate after the change.
+func parseLinkCheck(o *options) (*linkCheck, error) {
+	if o.verifyLink == 0 {
+		if o.verifyCall != "" {
+			return nil, errors.New("the -verify-call flag requires -verify-link")
+		}
+		return nil, nil
+	}
+	if o.verifyLink < 0 {
+		return nil, fmt.Errorf("invalid -verify-link %v: must be positive", o.verifyLink)
+	}
+	if o.verifyCall == "" {
+		return nil, errors.New("the -verify-link flag requires -verify-call, the callsign to send the test frame from")
+	}
+	if o.stdin || o.interactive || o.controlFIFO != "" || o.schedule != "" || o.rawCmd != "" || o.commands != "" || o.ax25Dest != "" || o.reopenBaud > 0 {
+		return nil, errors.New("the -verify-link flag only applies when setting a mode with -mode or another mode selection, without -reopen-baud")
+	}
+	call, err := ninotnc.ParseAddress(o.verifyCall)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -verify-call: %w", err)
+	}
+	return &linkCheck{call: call, timeout: o.verifyLink}, nil
+}
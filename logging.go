@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// logger is shared with the ninotnc package, so -quiet and -debug apply to
+// its messages too.
+var logger ninotnc.Logger = ninotnc.StdLogger{}
+
+// setupLogging picks the log level from -quiet and -debug.
+func setupLogging(o *options) error {
+	level := ninotnc.LevelInfo
+	switch {
+	case o.quiet && o.debug:
+		return errors.New("-quiet and -debug cannot be used together")
+	case o.quiet:
+		level = ninotnc.LevelError
+	case o.debug:
+		level = ninotnc.LevelDebug
+	}
+	logger = ninotnc.StdLogger{Level: level}
+	ninotnc.SetLogger(logger)
+	return nil
+}
+
+// deviceLabels pairs -label with devices: a single label tags every device,
+// or a comma-separated list gives each device its own, in order.
+func deviceLabels(label string, devices []string) (map[string]string, error) {
+	labels := map[string]string{}
+	list := splitList(label)
+	switch len(list) {
+	case 0:
+	case 1:
+		for _, d := range devices {
+			labels[d] = list[0]
+		}
+	case len(devices):
+		for i, d := range devices {
+			labels[d] = list[i]
+		}
+	default:
+		return nil, fmt.Errorf("-label has %d labels for %d devices: give one, or one per device", len(list), len(devices))
+	}
+	return labels, nil
+}
+
+// setLogLabel tags every following log line, including the ninotnc
+// package's, with label; an empty label removes the tag.
+func setLogLabel(label string) {
+	if label == "" {
+		log.SetPrefix("")
+		return
+	}
+	log.SetFlags(log.Flags() | log.Lmsgprefix)
+	log.SetPrefix("[" + label + "] ")
+}
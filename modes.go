@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// describeMode renders a single mode table row as one line of text.
+func describeMode(m ninotnc.ModeInfo) string {
+	kind := "modern"
+	if m.Legacy {
+		kind = "legacy"
+	}
+	return fmt.Sprintf("Mode %d (DIP %s): %d baud, %d bps, %s %s, %s, %s (%s)",
+		m.Mode, m.DIP, m.Baud, m.Bps, m.Modulation, m.Protocol, m.Usage, m.Bandwidth, kind)
+}
+
+// tableColors holds the ANSI escapes printModeTable wraps rows in. The zero
+// value prints plain text.
+type tableColors struct {
+	modern, legacy string
+	// selected highlights the row for selectedMode instead.
+	selected     string
+	selectedMode int
+}
+
+const ansiReset = "\x1b[0m"
+
+// listColors returns the colours for -list on out: modern modes in green,
+// legacy ones dimmed and selected, the -mode given, if any, in bold reverse.
+// Colour is only used on a terminal, and never when NO_COLOR is set or TERM
+// is dumb, so pipes and scripts get plain text.
+func listColors(out *os.File, selected int, hasSelected bool) tableColors {
+	fi, err := out.Stat()
+	if err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+		return tableColors{}
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return tableColors{}
+	}
+	// The classic Windows console shows escapes literally; Windows Terminal
+	// understands them.
+	if runtime.GOOS == "windows" && os.Getenv("WT_SESSION") == "" {
+		return tableColors{}
+	}
+	c := tableColors{modern: "\x1b[32m", legacy: "\x1b[2m"}
+	if hasSelected {
+		c.selected, c.selectedMode = "\x1b[1;7m", selected
+	}
+	return c
+}
+
+// row wraps one formatted table row in the colour for m. The escapes take
+// no space on screen, so padding inside the row keeps the columns aligned.
+func (c tableColors) row(m ninotnc.ModeInfo, text string) string {
+	code := c.modern
+	if m.Legacy {
+		code = c.legacy
+	}
+	if c.selected != "" && m.Mode == c.selectedMode {
+		code = c.selected
+	}
+	if code == "" {
+		return text
+	}
+	return code + text + ansiReset
+}
+
+// printModeTable writes modes, split into modern and legacy, as aligned
+// columns. A section with no modes is left out.
+func printModeTable(w io.Writer, modes []ninotnc.ModeInfo, c tableColors) {
+	var modern, legacy []ninotnc.ModeInfo
+	for _, m := range modes {
+		if m.Legacy {
+			legacy = append(legacy, m)
+		} else {
+			modern = append(modern, m)
+		}
+	}
+	if len(modern) > 0 {
+		fmt.Fprintln(w, "Modern Modes:")
+		fmt.Fprintf(w, "  %-8s%-7s%-7s%-6s%-7s%-9s%-10s%s\n", "Mode", "DIP", "Baud", "bps", "Mod", "Proto", "Usage", "BW")
+		for _, m := range modern {
+			fmt.Fprintln(w, c.row(m, fmt.Sprintf("  %-8d%-7s%-7d%-6d%-7s%-9s%-10s%s", m.Mode, m.DIP, m.Baud, m.Bps, m.Modulation, m.Protocol, m.Usage, m.Bandwidth)))
+		}
+	}
+	if len(modern) > 0 && len(legacy) > 0 {
+		fmt.Fprintln(w)
+	}
+	if len(legacy) > 0 {
+		fmt.Fprintln(w, "Legacy Modes:")
+		fmt.Fprintf(w, "  %-8s%-7s%-7s%-6s%-7s%-9s%-21s%-7s%s\n", "Mode", "DIP", "Baud", "bps", "Mod", "Proto", "Superseded by", "Usage", "BW")
+		for _, m := range legacy {
+			fmt.Fprintln(w, c.row(m, fmt.Sprintf("  %-8d%-7s%-7d%-6d%-7s%-9s%-21s%-7s%s", m.Mode, m.DIP, m.Baud, m.Bps, m.Modulation, m.Protocol, m.SupersededBy, m.Usage, m.Bandwidth)))
+		}
+	}
+}
+
+// printDIP draws the four DIP switches in the positions that select m, with
+// switch 1 on the left as on the board.
+func printDIP(w io.Writer, m ninotnc.ModeInfo) {
+	fmt.Fprintf(w, "Mode %d (%s): DIP %s\n\n", m.Mode, m.Name(), m.DIP)
+	fmt.Fprintln(w, "      1   2   3   4")
+	fmt.Fprintln(w, "    +---+---+---+---+")
+	for _, row := range []struct {
+		label string
+		bit   byte
+	}{{"ON ", '1'}, {"OFF", '0'}} {
+		fmt.Fprintf(w, "%s |", row.label)
+		for i := range 4 {
+			if m.DIP[i] == row.bit {
+				fmt.Fprint(w, "###|")
+			} else {
+				fmt.Fprint(w, "   |")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintln(w, "    +---+---+---+---+")
+	fmt.Fprintln(w, "\nWith the switches set this way the TNC ignores set-mode commands; set all four ON (1111) to choose the mode with this tool instead.")
+}
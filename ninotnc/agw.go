@@ -0,0 +1,184 @@
+package ninotnc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+)
+
+// AGWPE frames start with a fixed 36-byte header, all integers little
+// endian:
+//
+//	offset  size  field
+//	0       1     radio port, 0 for the first
+//	1       3     reserved, zero
+//	4       1     data kind, an ASCII letter
+//	5       1     reserved, zero
+//	6       1     PID
+//	7       1     reserved, zero
+//	8       10    call from, NUL padded
+//	18      10    call to, NUL padded
+//	28      4     data length
+//	32      4     user, reserved, zero
+//
+// followed by data length bytes of data.
+const (
+	agwHeaderLen = 36
+	// agwMaxData bounds the data length accepted from the server, so a
+	// corrupt header cannot make us allocate gigabytes.
+	agwMaxData = 64 * 1024
+	// agwKindRaw sends, and delivers when monitoring is on, a raw frame whose
+	// first data byte is the KISS command byte.
+	agwKindRaw = 'K'
+	// agwKindRawMonitor toggles delivery of raw frames to this client.
+	agwKindRawMonitor = 'k'
+)
+
+// AGWKISSConnection carries KISS commands to a TNC through an AGWPE server,
+// using its raw frame ('K') mechanism: the un-escaped KISS command byte and
+// payload travel as the frame data. Many AGWPE servers only pass data frames
+// (command 0) through to the TNC, so whether set-mode reaches it depends on
+// the server.
+type AGWKISSConnection struct {
+	conn      net.Conn
+	radioPort byte
+	// buf holds bytes read past the last complete message, so a read that
+	// times out part way through a message does not lose its start.
+	buf []byte
+	// pending is the rest of a frame re-encoded as KISS for Read.
+	pending []byte
+}
+
+// NewAGWKISSConnectionContext connects to the AGWPE server at host:port and
+// addresses radioPort (0 for the first). It asks the server to forward raw
+// frames so acknowledgements can be read back.
+func NewAGWKISSConnectionContext(ctx context.Context, host string, port, radioPort int) (*AGWKISSConnection, error) {
+	if radioPort < 0 || radioPort > 255 {
+		return nil, fmt.Errorf("invalid AGW radio port %d: must be 0-255", radioPort)
+	}
+	addr := HostPort(host, port)
+	conn, err := dialTCP(ctx, nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	a := &AGWKISSConnection{conn: conn, radioPort: byte(radioPort)}
+	if _, err := writeFull(conn, a.header(agwKindRawMonitor, 0)); err != nil {
+		conn.Close()
+		return nil, withClass(ErrConnect, fmt.Errorf("enabling raw frame monitoring: %w", err))
+	}
+	logger.Infof("Connected to AGWPE server %s, radio port %d", addr, radioPort)
+	return a, nil
+}
+
+// header builds an AGWPE header of the given kind for dataLen bytes of data.
+func (a *AGWKISSConnection) header(kind byte, dataLen int) []byte {
+	h := make([]byte, agwHeaderLen)
+	h[0] = a.radioPort
+	h[4] = kind
+	binary.LittleEndian.PutUint32(h[28:], uint32(dataLen))
+	return h
+}
+
+// Write takes one or more complete KISS frames back to back, as
+// KISSConnection users send and BuildKISSFrames builds, and sends each one's
+// command byte and payload as its own AGWPE raw frame. Nothing is sent
+// unless every frame in b is well formed.
+func (a *AGWKISSConnection) Write(b []byte) (int, error) {
+	frames, err := splitFrames(b)
+	if err != nil {
+		return 0, fmt.Errorf("AGW transport needs whole KISS frames: %w", err)
+	}
+	var msgs []byte
+	for _, f := range frames {
+		// splitFrames has already checked each frame parses.
+		cmd, payload, _ := parseKISSFrame(f)
+		msgs = append(msgs, a.header(agwKindRaw, 1+len(payload))...)
+		msgs = append(msgs, cmd)
+		msgs = append(msgs, payload...)
+	}
+	if _, err := writeFull(a.conn, msgs); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Read returns the raw frames for our radio port re-encoded as KISS frames,
+// so the stream reads like the other transports'.
+func (a *AGWKISSConnection) Read(b []byte) (int, error) {
+	if len(a.pending) == 0 {
+		data, err := a.readMessage()
+		if err != nil {
+			return 0, err
+		}
+		a.pending = BuildKISSFrameCmd(data[0], data[1:])
+	}
+	n := copy(b, a.pending)
+	a.pending = a.pending[n:]
+	return n, nil
+}
+
+// ReadFrame returns the data of the next raw frame for our radio port, which
+// starts with the KISS command byte like frames from the other transports.
+// Other AGWPE messages are skipped.
+func (a *AGWKISSConnection) ReadFrame(timeout time.Duration) ([]byte, error) {
+	a.conn.SetReadDeadline(time.Now().Add(timeout))
+	defer a.conn.SetReadDeadline(time.Time{})
+	return a.readMessage()
+}
+
+// readMessage reads until a raw frame for our radio port is complete.
+func (a *AGWKISSConnection) readMessage() ([]byte, error) {
+	chunk := make([]byte, 4096)
+	for {
+		data, ok, err := a.nextMessage()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return data, nil
+		}
+		n, err := a.conn.Read(chunk)
+		a.buf = append(a.buf, chunk[:n]...)
+		if err != nil {
+			return nil, agwReadError(err)
+		}
+	}
+}
+
+// nextMessage removes complete messages from the buffer until it finds a raw
+// frame for our radio port.
+func (a *AGWKISSConnection) nextMessage() ([]byte, bool, error) {
+	for len(a.buf) >= agwHeaderLen {
+		n := binary.LittleEndian.Uint32(a.buf[28:])
+		if n > agwMaxData {
+			return nil, false, fmt.Errorf("AGW frame data length %d exceeds %d bytes", n, agwMaxData)
+		}
+		end := agwHeaderLen + int(n)
+		if len(a.buf) < end {
+			break
+		}
+		h, data := a.buf[:agwHeaderLen], a.buf[agwHeaderLen:end]
+		match := h[4] == agwKindRaw && h[0] == a.radioPort && len(data) > 0
+		data = append([]byte(nil), data...)
+		a.buf = a.buf[end:]
+		if match {
+			return data, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func agwReadError(err error) error {
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return ErrTimeout
+	}
+	return err
+}
+
+func (a *AGWKISSConnection) Close() error {
+	return a.conn.Close()
+}
@@ -0,0 +1,91 @@
+package ninotnc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+// readAGWMessages reads n AGWPE messages from r and returns their kind and
+// data.
+func readAGWMessages(r io.Reader, n int) ([]byte, [][]byte, error) {
+	var kinds []byte
+	var data [][]byte
+	for range n {
+		h := make([]byte, agwHeaderLen)
+		if _, err := io.ReadFull(r, h); err != nil {
+			return kinds, data, err
+		}
+		d := make([]byte, binary.LittleEndian.Uint32(h[28:]))
+		if _, err := io.ReadFull(r, d); err != nil {
+			return kinds, data, err
+		}
+		kinds = append(kinds, h[4])
+		data = append(data, d)
+	}
+	return kinds, data, nil
+}
+
+func TestAGWWriteSplitsFrames(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	a := &AGWKISSConnection{conn: client}
+
+	cmds := []Command{
+		{Cmd: KISS_CMD_SETHW, Payload: []byte{0x13}},
+		{Cmd: 0x01, Payload: []byte{0x32}},
+		{Cmd: KISS_CMD_DATA, Payload: []byte{KISS_FLAG, KISS_FESC}},
+	}
+	b := BuildKISSFrames(cmds)
+	type result struct {
+		kinds []byte
+		data  [][]byte
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		kinds, data, err := readAGWMessages(server, len(cmds))
+		done <- result{kinds, data, err}
+	}()
+	n, err := a.Write(b)
+	if err != nil || n != len(b) {
+		t.Fatalf("Write = %d, %v, want %d, nil", n, err, len(b))
+	}
+	r := <-done
+	if r.err != nil {
+		t.Fatalf("reading AGW messages: %v", r.err)
+	}
+	for i, c := range cmds {
+		if r.kinds[i] != agwKindRaw {
+			t.Errorf("message %d kind = %q, want %q", i, r.kinds[i], agwKindRaw)
+		}
+		want := append([]byte{c.Cmd}, c.Payload...)
+		if !bytes.Equal(r.data[i], want) {
+			t.Errorf("message %d data = % X, want % X", i, r.data[i], want)
+		}
+	}
+}
+
+func TestAGWWriteRejectsPartialFrames(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	a := &AGWKISSConnection{conn: client}
+	good := BuildKISSFrameCmd(KISS_CMD_SETHW, []byte{0x13})
+	for _, b := range [][]byte{
+		nil,
+		{0x06, 0x13},
+		append(bytes.Clone(good), 0x01),
+		append(bytes.Clone(good), KISS_FLAG, 0x01, 0x32),
+		append(bytes.Clone(good), KISS_FLAG, KISS_FESC, 0x41, KISS_FLAG),
+	} {
+		// Nothing reads the pipe, so a write that got as far as the
+		// connection would block rather than return.
+		if n, err := a.Write(b); err == nil {
+			t.Errorf("Write(% X) = %d, nil, want an error", b, n)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package ninotnc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AX.25 UI frame control field and "no layer 3" protocol identifier.
+const (
+	AX25_CTRL_UI  = 0x03
+	AX25_PID_NONE = 0xF0
+)
+
+// Address is an AX.25 station address: a callsign of one to six letters and
+// digits and an SSID of 0-15.
+type Address struct {
+	Call string
+	SSID int
+}
+
+// ParseAddress parses a callsign with an optional SSID, such as N0CALL or
+// N0CALL-7. Letters are upper-cased.
+func ParseAddress(s string) (Address, error) {
+	call, ssid, hasSSID := strings.Cut(strings.ToUpper(strings.TrimSpace(s)), "-")
+	a := Address{Call: call}
+	if hasSSID {
+		n, err := strconv.Atoi(ssid)
+		if err != nil {
+			return Address{}, fmt.Errorf("invalid AX.25 address %q: SSID must be a number", s)
+		}
+		a.SSID = n
+	}
+	if err := a.validate(); err != nil {
+		return Address{}, fmt.Errorf("invalid AX.25 address %q: %w", s, err)
+	}
+	return a, nil
+}
+
+func (a Address) validate() error {
+	if len(a.Call) < 1 || len(a.Call) > 6 {
+		return fmt.Errorf("callsign must be 1-6 characters")
+	}
+	for _, c := range a.Call {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return fmt.Errorf("callsign may only contain letters and digits")
+		}
+	}
+	if a.SSID < 0 || a.SSID > 15 {
+		return fmt.Errorf("SSID %d must be 0-15", a.SSID)
+	}
+	return nil
+}
+
+func (a Address) String() string {
+	if a.SSID == 0 {
+		return a.Call
+	}
+	return fmt.Sprintf("%s-%d", a.Call, a.SSID)
+}
+
+// encode returns the seven-byte address field: the callsign shifted left
+// one bit and padded with spaces, then the SSID byte. command sets the C
+// bit and last the end-of-address bit.
+func (a Address) encode(command, last bool) []byte {
+	b := make([]byte, 7)
+	call := fmt.Sprintf("%-6s", a.Call)
+	for i := range 6 {
+		b[i] = call[i] << 1
+	}
+	b[6] = 0x60 | byte(a.SSID)<<1
+	if command {
+		b[6] |= 0x80
+	}
+	if last {
+		b[6] |= 0x01
+	}
+	return b
+}
+
+// BuildUIFrame builds an AX.25 UI command frame from src to dest carrying
+// info, with no digipeaters and no layer 3 protocol. The FCS is left to the
+// TNC, so the result is ready to send as a KISS data frame payload.
+func BuildUIFrame(dest, src Address, info []byte) ([]byte, error) {
+	if err := dest.validate(); err != nil {
+		return nil, fmt.Errorf("invalid destination %v: %w", dest, err)
+	}
+	if err := src.validate(); err != nil {
+		return nil, fmt.Errorf("invalid source %v: %w", src, err)
+	}
+	frame := append(dest.encode(true, false), src.encode(false, true)...)
+	frame = append(frame, AX25_CTRL_UI, AX25_PID_NONE)
+	return append(frame, info...), nil
+}
@@ -0,0 +1,495 @@
+package ninotnc
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+const tcpKeepAlivePeriod = 30 * time.Second
+
+// ErrTimeout is returned when no frame arrives before a read times out.
+var ErrTimeout = errors.New("timed out waiting for response")
+
+// KISSConnection is a transport that KISS frames can be sent over. Read
+// returns the raw KISS byte stream, framing and escapes included, for
+// callers that parse it themselves, for example through a bufio.Reader;
+// bytes ReadFrame has buffered past the last frame are returned first.
+type KISSConnection interface {
+	io.ReadWriteCloser
+	// ReadFrame returns the un-escaped contents (command byte followed by
+	// payload) of the next KISS frame received within timeout.
+	ReadFrame(timeout time.Duration) ([]byte, error)
+}
+
+// readFrameDeadline reads a frame from a net.Conn or pollable file, bounding
+// the wait with a read deadline.
+func readFrameDeadline(conn interface{ SetReadDeadline(time.Time) error }, fr *frameReader, timeout time.Duration) ([]byte, error) {
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	defer conn.SetReadDeadline(time.Time{})
+	frame, err := fr.ReadFrame()
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil, ErrTimeout
+	}
+	return frame, err
+}
+
+// writeFull writes all of b, continuing after short writes, which serial
+// drivers in particular may return. A write that makes no progress without
+// an error fails with io.ErrShortWrite rather than looping forever.
+func writeFull(w io.Writer, b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := w.Write(b[written:])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+// TCPKISSConnection talks KISS over a TCP stream, as offered by most KISS
+// servers and TNC bridges.
+type TCPKISSConnection struct {
+	conn   net.Conn
+	reader *frameReader
+}
+
+// NewTCPKISSConnection dials host:port over TCP.
+func NewTCPKISSConnection(host string, port int) (*TCPKISSConnection, error) {
+	return NewTCPKISSConnectionContext(context.Background(), host, port)
+}
+
+// NewTCPKISSConnectionContext is like NewTCPKISSConnection but aborts the dial
+// when ctx is done; give ctx a deadline to bound the connect time. TCP
+// keepalive is enabled so a TNC server that vanishes is eventually noticed.
+func NewTCPKISSConnectionContext(ctx context.Context, host string, port int) (*TCPKISSConnection, error) {
+	return NewTCPKISSConnectionVia(ctx, nil, host, port)
+}
+
+// ContextDialer opens network connections on behalf of the TCP and TLS
+// transports, for example through a SOCKS5 proxy. It matches
+// golang.org/x/net/proxy.ContextDialer.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// NewTCPKISSConnectionVia is like NewTCPKISSConnectionContext but dials with
+// d, or directly when d is nil.
+func NewTCPKISSConnectionVia(ctx context.Context, d ContextDialer, host string, port int) (*TCPKISSConnection, error) {
+	addr := HostPort(host, port)
+	conn, err := dialTCP(ctx, d, addr)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Connected to %s via TCP", addr)
+	return &TCPKISSConnection{conn: conn, reader: &frameReader{r: conn}}, nil
+}
+
+// NewTLSKISSConnectionContext is like NewTCPKISSConnectionContext but runs
+// KISS over TLS, for a KISS server wrapped in TLS (for example by stunnel).
+// A nil config verifies the server against the system roots. The handshake
+// is bounded by ctx too.
+func NewTLSKISSConnectionContext(ctx context.Context, host string, port int, config *tls.Config) (*TCPKISSConnection, error) {
+	return NewTLSKISSConnectionVia(ctx, nil, host, port, config)
+}
+
+// NewTLSKISSConnectionVia is like NewTLSKISSConnectionContext but dials with
+// d, or directly when d is nil.
+func NewTLSKISSConnectionVia(ctx context.Context, d ContextDialer, host string, port int, config *tls.Config) (*TCPKISSConnection, error) {
+	addr := HostPort(host, port)
+	if config == nil {
+		config = &tls.Config{}
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName = unbracket(host)
+	}
+	conn, err := dialTCP(ctx, d, addr)
+	if err != nil {
+		return nil, err
+	}
+	tc := tls.Client(conn, config)
+	if err := tc.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, withClass(ErrConnect, fmt.Errorf("TLS handshake with %s: %w", addr, err))
+	}
+	logger.Infof("Connected to %s via TLS (%s)", addr, tls.VersionName(tc.ConnectionState().Version))
+	return &TCPKISSConnection{conn: tc, reader: &frameReader{r: tc}}, nil
+}
+
+// HostPort joins host and port into a dial address, bracketing IPv6
+// literals such as ::1. A host that is already bracketed is accepted too.
+func HostPort(host string, port int) string {
+	return net.JoinHostPort(unbracket(host), strconv.Itoa(port))
+}
+
+func unbracket(host string) string {
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		return host[1 : len(host)-1]
+	}
+	return host
+}
+
+// dialTCP connects to addr through d, or directly when d is nil, and enables
+// keepalive when the result is a plain TCP connection.
+func dialTCP(ctx context.Context, d ContextDialer, addr string) (net.Conn, error) {
+	if d == nil {
+		d = &net.Dialer{KeepAlive: -1}
+	}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return nil, withClass(ErrConnect, fmt.Errorf("connection to %s timed out: %w", addr, err))
+		}
+		return nil, withClass(ErrConnect, err)
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetKeepAlive(true)
+		tc.SetKeepAlivePeriod(tcpKeepAlivePeriod)
+	}
+	return conn, nil
+}
+
+func (t *TCPKISSConnection) Write(b []byte) (int, error) {
+	return writeFull(t.conn, b)
+}
+
+func (t *TCPKISSConnection) Read(b []byte) (int, error) {
+	if n := t.reader.buffered(b); n > 0 {
+		return n, nil
+	}
+	return t.conn.Read(b)
+}
+
+func (t *TCPKISSConnection) ReadFrame(timeout time.Duration) ([]byte, error) {
+	return readFrameDeadline(t.conn, t.reader, timeout)
+}
+
+func (t *TCPKISSConnection) Close() error {
+	return t.conn.Close()
+}
+
+// UDPKISSConnection sends KISS frames as UDP datagrams. UDP is connectionless,
+// so Write may report success even when nothing is listening on the far end.
+type UDPKISSConnection struct {
+	conn   net.Conn
+	reader *frameReader
+}
+
+// NewUDPKISSConnection returns a connection that sends datagrams to host:port.
+func NewUDPKISSConnection(host string, port int) (*UDPKISSConnection, error) {
+	addr := HostPort(host, port)
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, withClass(ErrConnect, err)
+	}
+	logger.Infof("Sending to %s via UDP", addr)
+	return &UDPKISSConnection{conn: conn, reader: &frameReader{r: conn}}, nil
+}
+
+// Write sends the datagram and then briefly waits for an ICMP port-unreachable
+// to be reported. Not every OS surfaces this, so a nil error is no guarantee
+// the frame was received. A reply that arrives during the wait is kept for
+// ReadFrame.
+func (u *UDPKISSConnection) Write(b []byte) (int, error) {
+	n, err := u.conn.Write(b)
+	if err != nil {
+		return n, err
+	}
+	// A datagram cannot be continued, so a partial one is an error.
+	if n < len(b) {
+		return n, io.ErrShortWrite
+	}
+	u.conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	defer u.conn.SetReadDeadline(time.Time{})
+	buf := make([]byte, 4096)
+	m, err := u.conn.Read(buf)
+	u.reader.buf = append(u.reader.buf, buf[:m]...)
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return n, fmt.Errorf("nothing listening at %s: %w", u.conn.RemoteAddr(), err)
+	}
+	return n, nil
+}
+
+// Read returns a datagram, or the part of one that fits in b. The rest of a
+// datagram that does not fit is lost, as with any UDP read.
+func (u *UDPKISSConnection) Read(b []byte) (int, error) {
+	if n := u.reader.buffered(b); n > 0 {
+		return n, nil
+	}
+	return u.conn.Read(b)
+}
+
+func (u *UDPKISSConnection) ReadFrame(timeout time.Duration) ([]byte, error) {
+	return readFrameDeadline(u.conn, u.reader, timeout)
+}
+
+func (u *UDPKISSConnection) Close() error {
+	return u.conn.Close()
+}
+
+// SerialKISSConnection talks KISS to a TNC attached to a local serial port.
+type SerialKISSConnection struct {
+	port         serial.Port
+	reader       *frameReader
+	writeTimeout time.Duration
+}
+
+// serialDeadlineReader adapts the per-read timeout of serial.Port to an
+// overall deadline, reporting ErrTimeout once it passes. With interByte set,
+// each read that returns data extends the deadline to at least interByte
+// later, so a reply still trickling in when the deadline comes is not cut
+// off while bytes keep arriving.
+type serialDeadlineReader struct {
+	port      serial.Port
+	deadline  time.Time
+	interByte time.Duration
+}
+
+func (d *serialDeadlineReader) Read(b []byte) (int, error) {
+	remaining := time.Until(d.deadline)
+	if remaining <= 0 {
+		return 0, ErrTimeout
+	}
+	if err := d.port.SetReadTimeout(remaining); err != nil {
+		return 0, err
+	}
+	n, err := d.port.Read(b)
+	if n == 0 && err == nil {
+		return 0, ErrTimeout
+	}
+	if n > 0 && d.interByte > 0 {
+		if next := time.Now().Add(d.interByte); next.After(d.deadline) {
+			d.deadline = next
+		}
+	}
+	return n, err
+}
+
+// SerialOptions sets the line settings of a serial connection. The zero
+// value is 8N1 without flow control, which is what a NinoTNC expects.
+type SerialOptions struct {
+	// DataBits is 5 to 8; 0 means 8.
+	DataBits int
+	// Parity is none, even, odd, mark or space; empty means none.
+	Parity string
+	// StopBits is 1, 1.5 or 2; empty means 1.
+	StopBits string
+	// FlowControl is none or rtscts; empty means none. Hardware flow
+	// control is only supported on Linux.
+	FlowControl string
+	// DTR and RTS, when non-nil, drive the modem control lines right after
+	// the port is opened, before anything is written. nil leaves them as the
+	// driver set them.
+	DTR *bool
+	RTS *bool
+	// WriteTimeout, when positive, bounds how long Write and Drain may
+	// block, for a device that has stopped taking data, for example after a
+	// lost XON. On timeout the port is closed and the call fails.
+	WriteTimeout time.Duration
+	// ReadBufferSize is how many bytes each read from the port asks for; 0
+	// means DefaultReadBufferSize.
+	ReadBufferSize int
+	// InterByteTimeout, when positive, lets a reply that is still arriving
+	// run past the ReadFrame timeout for as long as each read brings data
+	// within InterByteTimeout of the last, for links such as some USB hubs
+	// that deliver bytes in dribs and drabs. Zero applies the ReadFrame
+	// timeout alone.
+	InterByteTimeout time.Duration
+}
+
+// DefaultReadBufferSize is the size of each read from a connection, enough
+// for any frame a NinoTNC sends in one go.
+const DefaultReadBufferSize = 4096
+
+var serialParities = map[string]serial.Parity{
+	"none":  serial.NoParity,
+	"even":  serial.EvenParity,
+	"odd":   serial.OddParity,
+	"mark":  serial.MarkParity,
+	"space": serial.SpaceParity,
+}
+
+var serialStopBits = map[string]serial.StopBits{
+	"1":   serial.OneStopBit,
+	"1.5": serial.OnePointFiveStopBits,
+	"2":   serial.TwoStopBits,
+}
+
+// Validate reports settings that are out of range or unknown.
+func (o SerialOptions) Validate() error {
+	if o.ReadBufferSize < 0 {
+		return fmt.Errorf("invalid read buffer size %d: must not be negative", o.ReadBufferSize)
+	}
+	if o.InterByteTimeout < 0 {
+		return fmt.Errorf("invalid inter-byte timeout %v: must not be negative", o.InterByteTimeout)
+	}
+	_, err := o.mode(0)
+	return err
+}
+
+// mode converts o into the serial library's settings for baud.
+func (o SerialOptions) mode(baud int) (*serial.Mode, error) {
+	dataBits := o.DataBits
+	if dataBits == 0 {
+		dataBits = 8
+	}
+	if dataBits < 5 || dataBits > 8 {
+		return nil, fmt.Errorf("invalid data bits %d: must be 5-8", o.DataBits)
+	}
+	parity, ok := serialParities[strings.ToLower(cmp.Or(o.Parity, "none"))]
+	if !ok {
+		return nil, fmt.Errorf("invalid parity %q: must be none, even, odd, mark or space", o.Parity)
+	}
+	stopBits, ok := serialStopBits[cmp.Or(o.StopBits, "1")]
+	if !ok {
+		return nil, fmt.Errorf("invalid stop bits %q: must be 1, 1.5 or 2", o.StopBits)
+	}
+	switch strings.ToLower(cmp.Or(o.FlowControl, "none")) {
+	case "none", "rtscts":
+	default:
+		return nil, fmt.Errorf("invalid flow control %q: must be none or rtscts", o.FlowControl)
+	}
+	return &serial.Mode{BaudRate: baud, DataBits: dataBits, Parity: parity, StopBits: stopBits}, nil
+}
+
+// String describes o in the usual shorthand, such as 8N1.
+func (o SerialOptions) String() string {
+	m, err := o.mode(0)
+	if err != nil {
+		return "invalid"
+	}
+	p := strings.ToUpper(cmp.Or(o.Parity, "none"))[:1]
+	s := fmt.Sprintf("%d%s%s", m.DataBits, p, cmp.Or(o.StopBits, "1"))
+	if strings.EqualFold(o.FlowControl, "rtscts") {
+		s += " RTS/CTS"
+	}
+	if o.DTR != nil {
+		s += " DTR " + onOff(*o.DTR)
+	}
+	if o.RTS != nil {
+		s += " RTS " + onOff(*o.RTS)
+	}
+	return s
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// NewSerialKISSConnection opens portName at baud, 8N1.
+func NewSerialKISSConnection(portName string, baud int) (*SerialKISSConnection, error) {
+	return NewSerialKISSConnectionWithOptions(portName, baud, SerialOptions{})
+}
+
+// NewSerialKISSConnectionWithOptions is like NewSerialKISSConnection with
+// other line settings.
+func NewSerialKISSConnectionWithOptions(portName string, baud int, opts SerialOptions) (*SerialKISSConnection, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	mode, err := opts.mode(baud)
+	if err != nil {
+		return nil, err
+	}
+	ser, err := serial.Open(portName, mode)
+	if err != nil {
+		return nil, withClass(ErrConnect, err)
+	}
+	if strings.EqualFold(opts.FlowControl, "rtscts") {
+		if err := enableRTSCTS(portName); err != nil {
+			ser.Close()
+			return nil, withClass(ErrConnect, fmt.Errorf("enabling RTS/CTS flow control on %s: %w", portName, err))
+		}
+	}
+	if opts.DTR != nil {
+		if err := ser.SetDTR(*opts.DTR); err != nil {
+			ser.Close()
+			return nil, withClass(ErrConnect, fmt.Errorf("setting DTR on %s: %w", portName, err))
+		}
+	}
+	if opts.RTS != nil {
+		if err := ser.SetRTS(*opts.RTS); err != nil {
+			ser.Close()
+			return nil, withClass(ErrConnect, fmt.Errorf("setting RTS on %s: %w", portName, err))
+		}
+	}
+	logger.Infof("Opened serial port %s at %d baud %s", portName, baud, opts)
+	reader := &frameReader{r: &serialDeadlineReader{port: ser, interByte: opts.InterByteTimeout}, size: opts.ReadBufferSize}
+	return &SerialKISSConnection{port: ser, reader: reader, writeTimeout: opts.WriteTimeout}, nil
+}
+
+func (s *SerialKISSConnection) Write(b []byte) (int, error) {
+	return s.withWriteTimeout("write", func() (int, error) { return writeFull(s.port, b) })
+}
+
+// withWriteTimeout runs f, which may block on the port, giving up after
+// s.writeTimeout. serial.Port has no write deadline, so the port is closed
+// to release f, whose result is then discarded.
+func (s *SerialKISSConnection) withWriteTimeout(op string, f func() (int, error)) (int, error) {
+	if s.writeTimeout <= 0 {
+		return f()
+	}
+	type result struct {
+		n   int
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		n, err := f()
+		done <- result{n, err}
+	}()
+	select {
+	case r := <-done:
+		return r.n, r.err
+	case <-time.After(s.writeTimeout):
+		s.port.Close()
+		return 0, withClass(ErrWrite, fmt.Errorf("serial %s did not complete within %v; port closed", op, s.writeTimeout))
+	}
+}
+
+// Read blocks until at least one byte arrives.
+func (s *SerialKISSConnection) Read(b []byte) (int, error) {
+	if n := s.reader.buffered(b); n > 0 {
+		return n, nil
+	}
+	if err := s.port.SetReadTimeout(serial.NoTimeout); err != nil {
+		return 0, err
+	}
+	return s.port.Read(b)
+}
+
+func (s *SerialKISSConnection) ReadFrame(timeout time.Duration) ([]byte, error) {
+	s.reader.r.(*serialDeadlineReader).deadline = time.Now().Add(timeout)
+	return s.reader.ReadFrame()
+}
+
+// Drain blocks until all written bytes have left the serial port.
+func (s *SerialKISSConnection) Drain() error {
+	_, err := s.withWriteTimeout("drain", func() (int, error) { return 0, s.port.Drain() })
+	return err
+}
+
+func (s *SerialKISSConnection) Close() error {
+	return s.port.Close()
+}
@@ -0,0 +1,313 @@
+package ninotnc
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// shortWriter accepts only one byte on its first write, then everything.
+type shortWriter struct {
+	bytes.Buffer
+	calls int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if w.calls == 1 && len(p) > 1 {
+		return w.Buffer.Write(p[:1])
+	}
+	return w.Buffer.Write(p)
+}
+
+// stuckWriter never takes any bytes, and never reports an error either.
+type stuckWriter struct{ calls int }
+
+func (w *stuckWriter) Write(p []byte) (int, error) {
+	w.calls++
+	return 0, nil
+}
+
+func TestWriteFullShortWrite(t *testing.T) {
+	frame := []byte{KISS_FLAG, KISS_CMD_SETHW, 0x13, KISS_FLAG}
+	w := &shortWriter{}
+	n, err := writeFull(w, frame)
+	if err != nil || n != len(frame) {
+		t.Fatalf("writeFull = %d, %v, want %d, nil", n, err, len(frame))
+	}
+	if !bytes.Equal(w.Bytes(), frame) {
+		t.Errorf("wrote % X, want % X", w.Bytes(), frame)
+	}
+	if w.calls != 2 {
+		t.Errorf("writer called %d times, want 2", w.calls)
+	}
+}
+
+func TestWriteFullNoProgress(t *testing.T) {
+	w := &stuckWriter{}
+	n, err := writeFull(w, []byte{KISS_FLAG, KISS_CMD_SETHW, 0x13, KISS_FLAG})
+	if n != 0 || !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("writeFull = %d, %v, want 0, io.ErrShortWrite", n, err)
+	}
+	if w.calls != 1 {
+		t.Errorf("writer called %d times, want 1", w.calls)
+	}
+}
+
+// stuckPort is a serial.Port whose writes block until it is closed, like a
+// port held off by flow control. Methods the test does not use are left to
+// the nil embedded interface.
+type stuckPort struct {
+	serial.Port
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (p *stuckPort) Write(b []byte) (int, error) {
+	<-p.closed
+	return 0, io.ErrClosedPipe
+}
+
+func (p *stuckPort) Close() error {
+	p.closeOnce.Do(func() { close(p.closed) })
+	return nil
+}
+
+func TestSerialWriteTimeout(t *testing.T) {
+	const timeout = 100 * time.Millisecond
+	port := &stuckPort{closed: make(chan struct{})}
+	conn := &SerialKISSConnection{port: port, writeTimeout: timeout}
+
+	start := time.Now()
+	n, err := conn.Write([]byte{KISS_FLAG, KISS_CMD_SETHW, 0x13, KISS_FLAG})
+	elapsed := time.Since(start)
+	if n != 0 || !errors.Is(err, ErrWrite) {
+		t.Fatalf("Write = %d, %v, want 0 and an ErrWrite", n, err)
+	}
+	if elapsed < timeout || elapsed > timeout+time.Second {
+		t.Errorf("Write returned after %v, want about %v", elapsed, timeout)
+	}
+	select {
+	case <-port.closed:
+	default:
+		t.Error("port was not closed to release the blocked write")
+	}
+}
+
+// TestUDPWriteOneFramePerDatagram checks a set-mode frame goes out as one
+// datagram holding exactly that KISS frame, with nothing before or after it.
+func TestUDPWriteOneFramePerDatagram(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	addr := pc.LocalAddr().(*net.UDPAddr)
+
+	conn, err := NewUDPKISSConnection("127.0.0.1", addr.Port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	frame, err := SetModeFrame(3, false, SetModeOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	buf := make([]byte, 4096)
+	pc.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("reading the datagram: %v", err)
+	}
+	got := buf[:n]
+	if !bytes.Equal(got, frame) {
+		t.Fatalf("datagram = % X, want % X", got, frame)
+	}
+	if frames := DecodeFrames(got); len(frames) != 1 {
+		t.Errorf("datagram holds %d frames, want exactly one", len(frames))
+	}
+	pc.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, _, err := pc.ReadFrom(buf); err == nil {
+		t.Errorf("unexpected second datagram % X", buf[:n])
+	}
+}
+
+func TestHostPort(t *testing.T) {
+	tests := []struct {
+		host string
+		port int
+		want string
+	}{
+		{"127.0.0.1", 8001, "127.0.0.1:8001"},
+		{"ninotnc.local", 8001, "ninotnc.local:8001"},
+		{"::1", 8001, "[::1]:8001"},
+		{"[::1]", 8001, "[::1]:8001"},
+		{"fe80::1%eth0", 8001, "[fe80::1%eth0]:8001"},
+	}
+	for _, tt := range tests {
+		if got := HostPort(tt.host, tt.port); got != tt.want {
+			t.Errorf("HostPort(%q, %d) = %q, want %q", tt.host, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestTCPDialIPv6(t *testing.T) {
+	ln, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer ln.Close()
+	accepted := make(chan []byte, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			accepted <- nil
+			return
+		}
+		defer c.Close()
+		buf := make([]byte, 64)
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		n, _ := c.Read(buf)
+		accepted <- buf[:n]
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	conn, err := NewTCPKISSConnection("::1", port)
+	if err != nil {
+		t.Fatalf("NewTCPKISSConnection(\"::1\", %d): %v", port, err)
+	}
+	defer conn.Close()
+	frame := []byte{KISS_FLAG, KISS_CMD_SETHW, 0x13, KISS_FLAG}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got := <-accepted; !bytes.Equal(got, frame) {
+		t.Errorf("server received % X, want % X", got, frame)
+	}
+}
+
+// testTLSServer serves TLS on 127.0.0.1 with a freshly generated self-signed
+// certificate, sending what the first accepted connection receives to got.
+// It returns the port and a pool trusting the certificate.
+func testTLSServer(t *testing.T) (int, *x509.CertPool, <-chan []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ninotnc test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	got := make(chan []byte, 1)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 64)
+			c.SetReadDeadline(time.Now().Add(time.Second))
+			n, err := c.Read(buf)
+			c.Close()
+			if err == nil {
+				got <- buf[:n]
+				return
+			}
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, pool, got
+}
+
+func TestTLSConnection(t *testing.T) {
+	port, pool, got := testTLSServer(t)
+	frame := []byte{KISS_FLAG, KISS_CMD_SETHW, 0x13, KISS_FLAG}
+
+	// Without the server's CA or InsecureSkipVerify the self-signed
+	// certificate must be rejected.
+	if conn, err := NewTLSKISSConnectionContext(context.Background(), "127.0.0.1", port, nil); err == nil {
+		conn.Close()
+		t.Fatal("handshake with an untrusted certificate succeeded")
+	} else if !errors.Is(err, ErrConnect) {
+		t.Errorf("untrusted certificate gave %v, want an ErrConnect", err)
+	}
+
+	conn, err := NewTLSKISSConnectionContext(context.Background(), "127.0.0.1", port, &tls.Config{RootCAs: pool})
+	if err != nil {
+		t.Fatalf("NewTLSKISSConnectionContext with the server's CA: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	select {
+	case b := <-got:
+		if !bytes.Equal(b, frame) {
+			t.Errorf("server received % X, want % X", b, frame)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("server received nothing")
+	}
+}
+
+func TestTLSConnectionInsecure(t *testing.T) {
+	port, _, got := testTLSServer(t)
+	conn, err := NewTLSKISSConnectionContext(context.Background(), "127.0.0.1", port, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("NewTLSKISSConnectionContext with InsecureSkipVerify: %v", err)
+	}
+	defer conn.Close()
+	frame := []byte{KISS_FLAG, KISS_CMD_SETHW, 0x13, KISS_FLAG}
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	select {
+	case b := <-got:
+		if !bytes.Equal(b, frame) {
+			t.Errorf("server received % X, want % X", b, frame)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("server received nothing")
+	}
+}
@@ -0,0 +1,33 @@
+package ninotnc
+
+import "errors"
+
+// Error classes that callers can test for with errors.Is, alongside
+// ErrTimeout. The underlying error stays available to errors.As, and the
+// message is unchanged.
+var (
+	// ErrInvalidMode is returned for a mode outside the mode table.
+	ErrInvalidMode = errors.New("invalid mode")
+	// ErrInvalidOptions is returned when SetModeOptions cannot make a
+	// frame: a KISS port outside 0-15, an opcode that does not fit beside
+	// the port, or firmware too old for the set-mode command.
+	ErrInvalidOptions = errors.New("invalid set-mode options")
+	// ErrConnect is returned when a transport cannot be opened: a failed
+	// dial, TLS handshake or serial port open.
+	ErrConnect = errors.New("cannot connect to TNC")
+	// ErrWrite is returned when the set-mode command cannot be sent.
+	ErrWrite = errors.New("cannot send to TNC")
+)
+
+// classError tags err with one of the error classes above.
+type classError struct {
+	class error
+	err   error
+}
+
+func (e *classError) Error() string   { return e.err.Error() }
+func (e *classError) Unwrap() []error { return []error{e.class, e.err} }
+
+func withClass(class, err error) error {
+	return &classError{class: class, err: err}
+}
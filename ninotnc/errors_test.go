@@ -0,0 +1,97 @@
+package ninotnc_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+	"github.com/madpsy/ninotnc-set-mode/ninotnc/kisstest"
+)
+
+// TestErrorClasses checks each error class is returned by the code path
+// that fails, not just defined, and that the cause stays reachable.
+func TestErrorClasses(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("invalid mode", func(t *testing.T) {
+		_, err := ninotnc.SetModeWithOptions(ctx, kisstest.New(), 99, false, ninotnc.SetModeOptions{})
+		if !errors.Is(err, ninotnc.ErrInvalidMode) {
+			t.Errorf("mode 99 gave %v, want ErrInvalidMode", err)
+		}
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := ninotnc.SetModeWithOptions(ctx, kisstest.New(), 3, false, ninotnc.SetModeOptions{KISSPort: 16})
+		if !errors.Is(err, ninotnc.ErrInvalidOptions) {
+			t.Errorf("KISS port 16 gave %v, want ErrInvalidOptions", err)
+		}
+	})
+
+	t.Run("refused dial", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := ln.Addr().(*net.TCPAddr).Port
+		ln.Close()
+		conn, err := ninotnc.NewTCPKISSConnection("127.0.0.1", port)
+		if err == nil {
+			conn.Close()
+			t.Fatal("dial to a closed port succeeded")
+		}
+		if !errors.Is(err, ninotnc.ErrConnect) {
+			t.Errorf("refused dial gave %v, want ErrConnect", err)
+		}
+		var opErr *net.OpError
+		if !errors.As(err, &opErr) {
+			t.Errorf("refused dial gave %v, want the *net.OpError cause kept", err)
+		}
+	})
+
+	t.Run("failing writer", func(t *testing.T) {
+		conn := kisstest.New()
+		conn.Close()
+		_, err := ninotnc.SetModeWithOptions(ctx, conn, 3, false, ninotnc.SetModeOptions{})
+		if !errors.Is(err, ninotnc.ErrWrite) {
+			t.Errorf("write to a closed connection gave %v, want ErrWrite", err)
+		}
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("write to a closed connection gave %v, want the net.ErrClosed cause kept", err)
+		}
+	})
+
+	t.Run("ack timeout", func(t *testing.T) {
+		res, err := ninotnc.SetModeWithOptions(ctx, kisstest.New(), 3, false, ninotnc.SetModeOptions{AckTimeout: 10 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("SetModeWithOptions: %v", err)
+		}
+		if !errors.Is(res.AckErr, ninotnc.ErrTimeout) {
+			t.Errorf("AckErr = %v, want ErrTimeout", res.AckErr)
+		}
+	})
+}
+
+// TestAckIgnoresDataFrames feeds only a received data frame after a set-mode
+// command with a wide opcode whose low nibble is 0, and checks it is not
+// taken as the acknowledgement.
+func TestAckIgnoresDataFrames(t *testing.T) {
+	for _, cmd := range []byte{0x10, 0x20} {
+		conn := kisstest.New()
+		conn.Respond = func([]byte) []byte {
+			return ninotnc.BuildKISSFrameCmd(ninotnc.KISS_CMD_DATA, []byte("packet from another station"))
+		}
+		res, err := ninotnc.SetModeWithOptions(context.Background(), conn, 3, false, ninotnc.SetModeOptions{Command: cmd, AckTimeout: 20 * time.Millisecond})
+		if err != nil {
+			t.Fatalf("-cmd %02X: SetModeWithOptions: %v", cmd, err)
+		}
+		if res.Acknowledged() {
+			t.Errorf("-cmd %02X: data frame % X taken as the acknowledgement", cmd, res.Response)
+		}
+		if !errors.Is(res.AckErr, ninotnc.ErrTimeout) {
+			t.Errorf("-cmd %02X: AckErr = %v, want ErrTimeout", cmd, res.AckErr)
+		}
+	}
+}
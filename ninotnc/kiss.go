@@ -0,0 +1,327 @@
+// Package ninotnc builds and parses the KISS frames used to configure a
+// NinoTNC, and provides the TCP, UDP and serial transports to send them over.
+package ninotnc
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// KISS framing and command bytes.
+const (
+	KISS_FLAG      = 0xC0
+	KISS_FESC      = 0xDB // frame escape
+	KISS_TFEND     = 0xDC // transposed KISS_FLAG, follows KISS_FESC
+	KISS_TFESC     = 0xDD // transposed KISS_FESC, follows KISS_FESC
+	KISS_CMD_DATA  = 0x00
+	KISS_CMD_SETHW = 0x06
+)
+
+// fend delimits frames: KISS_FLAG unless changed with SetFrameDelimiter.
+var fend byte = KISS_FLAG
+
+// FrameDelimiter returns the byte that currently delimits frames.
+func FrameDelimiter() byte {
+	return fend
+}
+
+// SetFrameDelimiter replaces KISS_FLAG as the frame delimiter, for
+// experimental firmware that frames KISS differently. Framing, escaping and
+// decoding all follow it, with FESC TFEND standing for the new delimiter, so
+// it cannot be one of the escape bytes. Call it before opening connections,
+// as it is not synchronised with them.
+func SetFrameDelimiter(b byte) error {
+	switch b {
+	case KISS_FESC, KISS_TFEND, KISS_TFESC:
+		return fmt.Errorf("frame delimiter %02X clashes with the KISS escape bytes DB, DC and DD", b)
+	}
+	fend = b
+	return nil
+}
+
+// appendEscaped appends data to dst with the frame delimiter and FESC
+// escaped.
+func appendEscaped(dst, data []byte) []byte {
+	for _, b := range data {
+		switch b {
+		case fend:
+			dst = append(dst, KISS_FESC, KISS_TFEND)
+		case KISS_FESC:
+			dst = append(dst, KISS_FESC, KISS_TFESC)
+		default:
+			dst = append(dst, b)
+		}
+	}
+	return dst
+}
+
+var (
+	errTruncatedFrame = errors.New("truncated KISS frame")
+	errDanglingEscape = errors.New("dangling escape byte at end of frame")
+)
+
+// unescapeData reverses appendEscaped, mapping FESC TFEND (DB DC) back to the
+// frame delimiter (KISS_FLAG, C0) and FESC TFESC (DB DD) back to FESC (DB).
+// A stray FESC that does not start a valid escape sequence is passed through
+// unchanged.
+func unescapeData(data []byte) []byte {
+	out, _ := decodeEscapes(data)
+	return out
+}
+
+// decodeEscapes un-escapes data, passing invalid sequences through as-is and
+// reporting the first one found.
+func decodeEscapes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		if b != KISS_FESC {
+			buf.WriteByte(b)
+			continue
+		}
+		if i+1 == len(data) {
+			if err == nil {
+				err = errDanglingEscape
+			}
+			buf.WriteByte(b)
+			continue
+		}
+		switch data[i+1] {
+		case KISS_TFEND:
+			buf.WriteByte(fend)
+			i++
+		case KISS_TFESC:
+			buf.WriteByte(KISS_FESC)
+			i++
+		default:
+			if err == nil {
+				err = fmt.Errorf("invalid escape sequence DB %02X at offset %d", data[i+1], i)
+			}
+			buf.WriteByte(b)
+		}
+	}
+	return buf.Bytes(), err
+}
+
+// parseKISSFrame is the inverse of BuildKISSFrameCmd. The frame must be
+// bounded by KISS_FLAG on both ends and contain at least a command byte.
+func parseKISSFrame(frame []byte) (cmd byte, payload []byte, err error) {
+	if len(frame) < 3 || frame[0] != fend || frame[len(frame)-1] != fend {
+		return 0, nil, errTruncatedFrame
+	}
+	inner := frame[1 : len(frame)-1]
+	if i := bytes.IndexByte(inner, fend); i >= 0 {
+		return 0, nil, fmt.Errorf("unescaped frame delimiter at offset %d", i+1)
+	}
+	decoded, err := decodeEscapes(inner)
+	if err != nil {
+		return 0, nil, err
+	}
+	return decoded[0], decoded[1:], nil
+}
+
+// BuildKISSFrameCmd escapes the command byte and payload and wraps them in a
+// KISS frame. No real command is FEND or FESC, but one given by hand may be.
+func BuildKISSFrameCmd(cmd byte, payload []byte) []byte {
+	return AppendKISSFrameCmd(nil, cmd, payload)
+}
+
+// AppendKISSFrameCmd appends the frame BuildKISSFrameCmd would build to dst
+// and returns the extended slice. Reusing dst, for example with dst[:0],
+// avoids allocating when building many frames.
+func AppendKISSFrameCmd(dst []byte, cmd byte, payload []byte) []byte {
+	// Room for the frame if nothing needs escaping, which is the usual case.
+	dst = slices.Grow(dst, len(payload)+3)
+	dst = append(dst, fend)
+	dst = appendEscaped(dst, []byte{cmd})
+	dst = appendEscaped(dst, payload)
+	return append(dst, fend)
+}
+
+// Command is a KISS command byte, with the KISS port in its high nibble, and
+// its payload.
+type Command struct {
+	Cmd     byte
+	Payload []byte
+}
+
+// BuildKISSFrames builds a frame for each command and joins them, so that
+// they can go out back to back in a single write.
+func BuildKISSFrames(cmds []Command) []byte {
+	var frames []byte
+	for _, c := range cmds {
+		frames = AppendKISSFrameCmd(frames, c.Cmd, c.Payload)
+	}
+	return frames
+}
+
+// ValidateFrame checks that frame is a well-formed KISS frame: KISS_FLAG
+// appears only as the first and last byte, every escape is followed by
+// KISS_TFEND or KISS_TFESC, and there is a command byte.
+func ValidateFrame(frame []byte) error {
+	_, _, err := parseKISSFrame(frame)
+	return err
+}
+
+// ValidateFrames is like ValidateFrame for b holding one or more frames
+// back to back, as BuildKISSFrames builds them.
+func ValidateFrames(b []byte) error {
+	_, err := splitFrames(b)
+	return err
+}
+
+// splitFrames splits b, one or more whole KISS frames back to back, into
+// its frames, checking each as ValidateFrame does. Every byte must belong to
+// a frame, and b must hold at least one.
+func splitFrames(b []byte) ([][]byte, error) {
+	if len(b) == 0 {
+		return nil, errTruncatedFrame
+	}
+	var frames [][]byte
+	for rest := b; len(rest) > 0; {
+		end := -1
+		if rest[0] == fend {
+			end = bytes.IndexByte(rest[1:], fend)
+		}
+		if end < 0 {
+			return nil, fmt.Errorf("frame %d: %w", len(frames)+1, errTruncatedFrame)
+		}
+		frame := rest[:end+2]
+		if _, _, err := parseKISSFrame(frame); err != nil {
+			return nil, fmt.Errorf("frame %d: %w", len(frames)+1, err)
+		}
+		frames = append(frames, frame)
+		rest = rest[end+2:]
+	}
+	return frames, nil
+}
+
+// FrameHex formats a frame as space-separated hex bytes, such as
+// "C0 06 13 C0".
+func FrameHex(frame []byte) string {
+	return fmt.Sprintf("% X", frame)
+}
+
+// MaxFrameLen bounds how many bytes, still escaped, a frame read from the
+// TNC may hold. Set-mode acknowledgements are a few bytes and received
+// packets a few hundred, so only a stuck or misconfigured link exceeds it.
+const MaxFrameLen = 4096
+
+// ErrFrameTooLong is returned when a frame grows past MaxFrameLen without a
+// closing KISS_FLAG. The partial frame is discarded.
+var ErrFrameTooLong = fmt.Errorf("KISS frame longer than %d bytes", MaxFrameLen)
+
+// frameReader splits a byte stream into KISS frames, keeping any bytes read
+// past the end of one frame for the next call. Each read from r asks for up
+// to size bytes, DefaultReadBufferSize if it is 0.
+type frameReader struct {
+	r    io.Reader
+	buf  []byte
+	size int
+}
+
+func (f *frameReader) ReadFrame() ([]byte, error) {
+	chunk := make([]byte, cmp.Or(f.size, DefaultReadBufferSize))
+	for {
+		frame, ok := f.nextFrame()
+		if ok && len(frame) > MaxFrameLen {
+			return nil, ErrFrameTooLong
+		}
+		if ok {
+			return unescapeData(frame), nil
+		}
+		// nextFrame leaves an unfinished frame, flag included, at the
+		// start of the buffer.
+		if len(f.buf) > MaxFrameLen+1 {
+			f.buf = f.buf[:0]
+			return nil, ErrFrameTooLong
+		}
+		n, err := f.r.Read(chunk)
+		f.buf = append(f.buf, chunk[:n]...)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// buffered moves bytes read past the last frame into p, for Read calls mixed
+// with ReadFrame.
+func (f *frameReader) buffered(p []byte) int {
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n
+}
+
+// nextFrame extracts the first complete, non-empty frame from the buffer.
+// Bytes before the opening KISS_FLAG, such as line noise, are discarded, as
+// are empty frames between back-to-back flags.
+func (f *frameReader) nextFrame() ([]byte, bool) {
+	for {
+		start := bytes.IndexByte(f.buf, fend)
+		if start < 0 {
+			f.buf = f.buf[:0]
+			return nil, false
+		}
+		f.buf = f.buf[start:]
+		end := bytes.IndexByte(f.buf[1:], fend)
+		if end < 0 {
+			return nil, false
+		}
+		frame := f.buf[1 : end+1]
+		// The closing flag may also open the next frame.
+		f.buf = f.buf[end+1:]
+		if len(frame) > 0 {
+			return append([]byte(nil), frame...), true
+		}
+	}
+}
+
+// DecodedFrame is one frame found by DecodeFrames.
+type DecodedFrame struct {
+	Offset  int    // offset of the opening delimiter in the stream
+	Cmd     byte   // command byte: KISS port in the high nibble, command in the low
+	Payload []byte // un-escaped bytes after the command byte
+	Err     error  // set for a frame with a bad escape, or one cut off at the end
+}
+
+// DecodeFrames splits data, a raw KISS byte stream such as a serial capture,
+// into frames and un-escapes each. Bytes outside frames and empty frames are
+// skipped. Frames with a bad escape are still returned, decoded as well as
+// possible, with Err set.
+func DecodeFrames(data []byte) []DecodedFrame {
+	var frames []DecodedFrame
+	for off := 0; ; {
+		start := bytes.IndexByte(data[off:], fend)
+		if start < 0 {
+			return frames
+		}
+		start += off
+		end := bytes.IndexByte(data[start+1:], fend)
+		if end < 0 {
+			if start+1 < len(data) {
+				frames = append(frames, decodeFrame(start, data[start+1:], errTruncatedFrame))
+			}
+			return frames
+		}
+		end += start + 1
+		if end > start+1 {
+			frames = append(frames, decodeFrame(start, data[start+1:end], nil))
+		}
+		// The closing flag may also open the next frame.
+		off = end
+	}
+}
+
+func decodeFrame(offset int, inner []byte, err error) DecodedFrame {
+	decoded, escErr := decodeEscapes(inner)
+	f := DecodedFrame{Offset: offset, Cmd: decoded[0], Payload: decoded[1:], Err: err}
+	if f.Err == nil {
+		f.Err = escErr
+	}
+	return f
+}
@@ -0,0 +1,248 @@
+package ninotnc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"testing"
+	"testing/iotest"
+)
+
+func FuzzEscapeRoundTrip(f *testing.F) {
+	for _, seed := range [][]byte{
+		{},
+		{KISS_FLAG},
+		{KISS_FESC},
+		{KISS_FESC, KISS_TFEND},
+		{KISS_FESC, KISS_TFESC},
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		escaped := appendEscaped(nil, data)
+		if i := bytes.IndexByte(escaped, fend); i >= 0 {
+			t.Fatalf("escaped % X has a bare delimiter at offset %d", escaped, i)
+		}
+		if got := unescapeData(escaped); !bytes.Equal(got, data) {
+			t.Fatalf("unescapeData(appendEscaped(% X)) = % X", data, got)
+		}
+	})
+}
+
+func BenchmarkBuildKISSFrameCmd(b *testing.B) {
+	payload := bytes.Repeat([]byte{0x55, KISS_FLAG}, 100)
+	b.ReportAllocs()
+	for b.Loop() {
+		BuildKISSFrameCmd(KISS_CMD_DATA, payload)
+	}
+}
+
+func BenchmarkAppendKISSFrameCmd(b *testing.B) {
+	payload := bytes.Repeat([]byte{0x55, KISS_FLAG}, 100)
+	var buf []byte
+	b.ReportAllocs()
+	for b.Loop() {
+		buf = AppendKISSFrameCmd(buf[:0], KISS_CMD_DATA, payload)
+	}
+}
+
+func TestAppendKISSFrameCmdNoAllocs(t *testing.T) {
+	payload := []byte{0x01, KISS_FLAG, KISS_FESC, 0x02}
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = AppendKISSFrameCmd(buf[:0], KISS_FESC, payload)
+	})
+	if allocs != 0 {
+		t.Errorf("AppendKISSFrameCmd into a buffer with room made %v allocations, want 0", allocs)
+	}
+}
+
+func TestUnescapeData(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []byte
+		want []byte
+	}{
+		{"empty", nil, nil},
+		{"plain", []byte{0x01, 0x02}, []byte{0x01, 0x02}},
+		{"escaped delimiter", []byte{KISS_FESC, KISS_TFEND}, []byte{KISS_FLAG}},
+		{"escaped escape", []byte{KISS_FESC, KISS_TFESC}, []byte{KISS_FESC}},
+		{"adjacent escapes", []byte{KISS_FESC, KISS_TFEND, KISS_FESC, KISS_TFESC}, []byte{KISS_FLAG, KISS_FESC}},
+		{"escape at start", []byte{KISS_FESC, KISS_TFEND, 0x01}, []byte{KISS_FLAG, 0x01}},
+		{"escape at end", []byte{0x01, KISS_FESC, KISS_TFESC}, []byte{0x01, KISS_FESC}},
+		{"bare TFEND and TFESC", []byte{KISS_TFEND, KISS_TFESC}, []byte{KISS_TFEND, KISS_TFESC}},
+		{"dangling escape", []byte{0x01, KISS_FESC}, []byte{0x01, KISS_FESC}},
+		{"invalid escape", []byte{KISS_FESC, 0x41}, []byte{KISS_FESC, 0x41}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unescapeData(tt.in); !bytes.Equal(got, tt.want) {
+				t.Errorf("unescapeData(% X) = % X, want % X", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKISSFrameRoundTrip(t *testing.T) {
+	payloads := [][]byte{
+		nil,
+		{0x13},
+		{KISS_FLAG},
+		{KISS_FESC},
+		{KISS_FESC, KISS_TFEND},
+		{KISS_FESC, KISS_TFESC},
+		{KISS_FLAG, KISS_FLAG, KISS_FESC, KISS_FESC},
+		{KISS_TFEND, KISS_TFESC},
+	}
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 100 {
+		p := make([]byte, rng.IntN(64))
+		for i := range p {
+			p[i] = byte(rng.UintN(256))
+		}
+		payloads = append(payloads, p)
+	}
+	for _, cmd := range []byte{KISS_CMD_SETHW, KISS_CMD_DATA, KISS_FLAG, KISS_FESC} {
+		for _, payload := range payloads {
+			frame := BuildKISSFrameCmd(cmd, payload)
+			gotCmd, gotPayload, err := parseKISSFrame(frame)
+			if err != nil {
+				t.Fatalf("parseKISSFrame(% X): %v", frame, err)
+			}
+			if gotCmd != cmd || !bytes.Equal(gotPayload, payload) {
+				t.Errorf("parseKISSFrame(% X) = %02X % X, want %02X % X", frame, gotCmd, gotPayload, cmd, payload)
+			}
+		}
+	}
+}
+
+func TestParseKISSFrameErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+	}{
+		{"empty", nil},
+		{"flags only", []byte{KISS_FLAG, KISS_FLAG}},
+		{"missing opening flag", []byte{0x06, 0x13, KISS_FLAG}},
+		{"missing closing flag", []byte{KISS_FLAG, 0x06, 0x13}},
+		{"unescaped inner flag", []byte{KISS_FLAG, 0x06, KISS_FLAG, 0x13, KISS_FLAG}},
+		{"dangling escape", []byte{KISS_FLAG, 0x06, KISS_FESC, KISS_FLAG}},
+		{"invalid escape", []byte{KISS_FLAG, 0x06, KISS_FESC, 0x41, KISS_FLAG}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := parseKISSFrame(tt.frame); err == nil {
+				t.Errorf("parseKISSFrame(% X) succeeded, want an error", tt.frame)
+			}
+		})
+	}
+}
+
+func TestFrameReader(t *testing.T) {
+	ack := []byte{KISS_FLAG, 0x06, 0x13, KISS_FLAG}
+	status := []byte{KISS_FLAG, 0x06, KISS_FESC, KISS_TFEND, KISS_FLAG}
+	tests := []struct {
+		name string
+		r    io.Reader
+		want [][]byte
+	}{
+		{"leading garbage", bytes.NewReader(append([]byte{0x01, 0x02, 0x03}, ack...)), [][]byte{{0x06, 0x13}}},
+		{"back-to-back flags", bytes.NewReader(append([]byte{KISS_FLAG, KISS_FLAG, KISS_FLAG}, ack...)), [][]byte{{0x06, 0x13}}},
+		{"shared flag between frames", bytes.NewReader([]byte{KISS_FLAG, 0x06, 0x13, KISS_FLAG, 0x06, 0x14, KISS_FLAG}), [][]byte{{0x06, 0x13}, {0x06, 0x14}}},
+		{"split across reads", iotest.OneByteReader(bytes.NewReader(append(bytes.Clone(ack), status...))), [][]byte{{0x06, 0x13}, {0x06, KISS_FLAG}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fr := &frameReader{r: tt.r}
+			for _, want := range tt.want {
+				got, err := fr.ReadFrame()
+				if err != nil {
+					t.Fatalf("ReadFrame: %v", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("ReadFrame = % X, want % X", got, want)
+				}
+			}
+			if got, err := fr.ReadFrame(); err != io.EOF {
+				t.Errorf("ReadFrame after the last frame = % X, %v, want io.EOF", got, err)
+			}
+		})
+	}
+}
+
+func TestFrameReaderTooLong(t *testing.T) {
+	long := append([]byte{KISS_FLAG}, bytes.Repeat([]byte{0x01}, MaxFrameLen+10)...)
+	ack := []byte{KISS_FLAG, 0x06, 0x13, KISS_FLAG}
+	fr := &frameReader{r: io.MultiReader(bytes.NewReader(long), bytes.NewReader(ack)), size: 256}
+	if _, err := fr.ReadFrame(); !errors.Is(err, ErrFrameTooLong) {
+		t.Fatalf("ReadFrame of an unterminated run = %v, want ErrFrameTooLong", err)
+	}
+	if len(fr.buf) != 0 {
+		t.Errorf("buffer holds %d bytes after ErrFrameTooLong, want it reset", len(fr.buf))
+	}
+	got, err := fr.ReadFrame()
+	if err != nil || !bytes.Equal(got, []byte{0x06, 0x13}) {
+		t.Errorf("ReadFrame after the reset = % X, %v, want 06 13", got, err)
+	}
+}
+
+func TestValidateFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame []byte
+		ok    bool
+	}{
+		{"valid", []byte{KISS_FLAG, KISS_CMD_SETHW, 0x13, KISS_FLAG}, true},
+		{"valid with escapes", []byte{KISS_FLAG, KISS_CMD_DATA, KISS_FESC, KISS_TFEND, KISS_FESC, KISS_TFESC, KISS_FLAG}, true},
+		{"command byte only", []byte{KISS_FLAG, KISS_CMD_SETHW, KISS_FLAG}, true},
+		{"missing both flags", []byte{KISS_CMD_SETHW, 0x13}, false},
+		{"missing opening flag", []byte{KISS_CMD_SETHW, 0x13, KISS_FLAG}, false},
+		{"missing closing flag", []byte{KISS_FLAG, KISS_CMD_SETHW, 0x13}, false},
+		{"inner FEND", []byte{KISS_FLAG, KISS_CMD_SETHW, KISS_FLAG, 0x13, KISS_FLAG}, false},
+		{"bad escape", []byte{KISS_FLAG, KISS_CMD_SETHW, KISS_FESC, 0x13, KISS_FLAG}, false},
+		{"escape before closing flag", []byte{KISS_FLAG, KISS_CMD_SETHW, KISS_FESC, KISS_FLAG}, false},
+		{"flag only", []byte{KISS_FLAG}, false},
+		{"flags only", []byte{KISS_FLAG, KISS_FLAG}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFrame(tt.frame)
+			if tt.ok && err != nil {
+				t.Errorf("ValidateFrame(% X) = %v, want nil", tt.frame, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("ValidateFrame(% X) = nil, want an error", tt.frame)
+			}
+		})
+	}
+}
+
+func TestValidateFrames(t *testing.T) {
+	one := []byte{KISS_FLAG, KISS_CMD_SETHW, 0x03, KISS_FLAG}
+	two := []byte{KISS_FLAG, 0x0A, 0x01, KISS_FLAG}
+	tests := []struct {
+		name string
+		b    []byte
+		ok   bool
+	}{
+		{"one frame", one, true},
+		{"two frames", append(bytes.Clone(one), two...), true},
+		{"empty", nil, false},
+		{"trailing byte", append(bytes.Clone(one), 0x01), false},
+		{"unterminated second frame", append(bytes.Clone(one), KISS_FLAG, 0x0A), false},
+		{"bad escape in second frame", append(bytes.Clone(one), KISS_FLAG, 0x0A, KISS_FESC, 0x41, KISS_FLAG), false},
+		{"shared delimiter", []byte{KISS_FLAG, KISS_CMD_SETHW, 0x03, KISS_FLAG, 0x0A, 0x01, KISS_FLAG}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateFrames(tt.b)
+			if tt.ok && err != nil {
+				t.Errorf("ValidateFrames(% X) = %v, want nil", tt.b, err)
+			}
+			if !tt.ok && err == nil {
+				t.Errorf("ValidateFrames(% X) = nil, want an error", tt.b)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package kisstest_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+	"github.com/madpsy/ninotnc-set-mode/ninotnc/kisstest"
+)
+
+func Example() {
+	conn := kisstest.New()
+	conn.Respond = kisstest.Echo
+	res, err := ninotnc.SetModeWithOptions(context.Background(), conn, 3, false,
+		ninotnc.SetModeOptions{AckTimeout: time.Second})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("effective mode:", res.EffectiveMode)
+	for _, f := range conn.Frames() {
+		fmt.Printf("sent: % X\n", f)
+	}
+	// Output:
+	// effective mode: 3
+	// sent: C0 06 13 C0
+}
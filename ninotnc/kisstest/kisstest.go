@@ -0,0 +1,141 @@
+// Package kisstest provides an in-memory ninotnc.KISSConnection for testing
+// code that talks to a NinoTNC without any hardware.
+//
+// A Conn records every frame written to it and answers reads from canned
+// bytes, queued up front or produced by a Respond function as each frame is
+// written. Echo makes it acknowledge commands the way a NinoTNC does.
+package kisstest
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// Conn is an in-memory ninotnc.KISSConnection. Reads never block: when no
+// complete frame is queued ReadFrame returns ninotnc.ErrTimeout straight
+// away, whatever the timeout. It is safe for concurrent use.
+type Conn struct {
+	// Respond, if set, is called with each frame written, as written, and
+	// whatever it returns is queued to be read back.
+	Respond func(frame []byte) []byte
+
+	mu      sync.Mutex
+	written [][]byte
+	in      []byte
+	closed  bool
+}
+
+// New returns a Conn with the given raw bytes, framing included, queued to
+// be read.
+func New(responses ...[]byte) *Conn {
+	c := &Conn{}
+	for _, r := range responses {
+		c.Queue(r)
+	}
+	return c
+}
+
+// Echo is a Respond function that sends each frame straight back, as a
+// NinoTNC acknowledges a set-mode command.
+func Echo(frame []byte) []byte {
+	return frame
+}
+
+// Queue adds raw bytes, framing included, to be read.
+func (c *Conn) Queue(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.in = append(c.in, b...)
+}
+
+// Frames returns a copy of every frame written so far, in order.
+func (c *Conn) Frames() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	frames := make([][]byte, len(c.written))
+	for i, f := range c.written {
+		frames[i] = bytes.Clone(f)
+	}
+	return frames
+}
+
+// Closed reports whether Close has been called.
+func (c *Conn) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// Write records b as one frame and queues Respond's reply, if any.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	c.written = append(c.written, bytes.Clone(b))
+	if c.Respond != nil {
+		c.in = append(c.in, c.Respond(bytes.Clone(b))...)
+	}
+	return len(b), nil
+}
+
+// Read returns queued bytes as they are, framing included.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+	if len(c.in) == 0 {
+		return 0, ninotnc.ErrTimeout
+	}
+	n := copy(b, c.in)
+	c.in = c.in[n:]
+	return n, nil
+}
+
+// ReadFrame returns the un-escaped contents of the next complete queued
+// frame, discarding anything before it.
+func (c *Conn) ReadFrame(timeout time.Duration) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, net.ErrClosed
+	}
+	fend := ninotnc.FrameDelimiter()
+	for {
+		start := bytes.IndexByte(c.in, fend)
+		if start < 0 {
+			c.in = c.in[:0]
+			return nil, ninotnc.ErrTimeout
+		}
+		end := bytes.IndexByte(c.in[start+1:], fend)
+		if end < 0 {
+			c.in = c.in[start:]
+			return nil, ninotnc.ErrTimeout
+		}
+		end += start + 1
+		frames := ninotnc.DecodeFrames(c.in[start : end+1])
+		// The closing delimiter may also open the next frame.
+		c.in = c.in[end:]
+		if len(frames) > 0 {
+			f := frames[0]
+			return append([]byte{f.Cmd}, f.Payload...), nil
+		}
+	}
+}
+
+// Close marks the connection closed; later calls fail with net.ErrClosed.
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+var _ ninotnc.KISSConnection = (*Conn)(nil)
@@ -0,0 +1,68 @@
+package ninotnc
+
+import (
+	"fmt"
+	"log"
+)
+
+// Logger receives the package's progress messages, such as connections made
+// and frames sent. Supply one with SetLogger to route them into a program's
+// own logging.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+// Level is the severity of a log message. As with log/slog, the zero value
+// is LevelInfo.
+type Level int
+
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// StdLogger writes messages at or above Level to Logger, log.Default() if nil.
+// The zero value logs everything but debug messages.
+type StdLogger struct {
+	Logger *log.Logger
+	Level  Level
+}
+
+func (l StdLogger) output(level Level, prefix, format string, args []any) {
+	if level < l.Level {
+		return
+	}
+	logger := l.Logger
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Output(3, prefix+fmt.Sprintf(format, args...))
+}
+
+func (l StdLogger) Debugf(format string, args ...any) { l.output(LevelDebug, "", format, args) }
+func (l StdLogger) Infof(format string, args ...any)  { l.output(LevelInfo, "", format, args) }
+func (l StdLogger) Warnf(format string, args ...any)  { l.output(LevelWarn, "Warning: ", format, args) }
+func (l StdLogger) Errorf(format string, args ...any) { l.output(LevelError, "", format, args) }
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(string, ...any) {}
+func (nopLogger) Infof(string, ...any)  {}
+func (nopLogger) Warnf(string, ...any)  {}
+func (nopLogger) Errorf(string, ...any) {}
+
+var logger Logger = StdLogger{}
+
+// SetLogger replaces the package's logger; nil discards all messages. Call it
+// before opening connections, as it is not synchronised with them.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	logger = l
+}
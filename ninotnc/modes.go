@@ -0,0 +1,168 @@
+package ninotnc
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ModeInfo describes one NinoTNC operating mode as selected by the DIP
+// switches or the set-mode KISS command.
+type ModeInfo struct {
+	Mode int    `json:"mode"`
+	DIP  string `json:"dip"` // switch positions, 1 for ON, most significant first
+	// Baud is the symbol rate and Bps the bit rate; they differ for QPSK.
+	Baud       int    `json:"baud"`
+	Bps        int    `json:"bps"`
+	Modulation string `json:"modulation"`
+	Protocol   string `json:"protocol"`
+	Usage      string `json:"usage"`     // radio type: FM, SSB or SSB/FM
+	Bandwidth  string `json:"bandwidth"` // channel width the mode needs
+	// Legacy modes are kept for compatibility with older stations, and
+	// SupersededBy names the mode recommended instead. It must be the Name
+	// of a mode in the table, exactly, so front-ends can look it up.
+	Legacy       bool   `json:"legacy"`
+	SupersededBy string `json:"superseded_by,omitempty"`
+}
+
+// modes is the single source of truth for the mode table, in the order it is
+// presented to operators.
+var modes = []ModeInfo{
+	{Mode: 1, DIP: "0001", Baud: 19200, Bps: 19200, Modulation: "4FSK", Protocol: "IL2Pc", Usage: "FM", Bandwidth: "25k"},
+	{Mode: 3, DIP: "0011", Baud: 9600, Bps: 9600, Modulation: "4FSK", Protocol: "IL2Pc", Usage: "FM", Bandwidth: "12.5k"},
+	{Mode: 2, DIP: "0010", Baud: 9600, Bps: 9600, Modulation: "GFSK", Protocol: "IL2Pc", Usage: "FM", Bandwidth: "25k"},
+	{Mode: 5, DIP: "0101", Baud: 3600, Bps: 3600, Modulation: "QPSK", Protocol: "IL2Pc", Usage: "FM", Bandwidth: "12.5k"},
+	{Mode: 11, DIP: "1011", Baud: 1200, Bps: 2400, Modulation: "QPSK", Protocol: "IL2Pc", Usage: "SSB/FM", Bandwidth: "2.4kHz"},
+	{Mode: 10, DIP: "1010", Baud: 1200, Bps: 1200, Modulation: "BPSK", Protocol: "IL2Pc", Usage: "SSB/FM", Bandwidth: "2.4kHz"},
+	{Mode: 9, DIP: "1001", Baud: 300, Bps: 600, Modulation: "QPSK", Protocol: "IL2Pc", Usage: "SSB", Bandwidth: "500Hz"},
+	{Mode: 8, DIP: "1000", Baud: 300, Bps: 300, Modulation: "BPSK", Protocol: "IL2Pc", Usage: "SSB", Bandwidth: "500Hz"},
+	{Mode: 14, DIP: "1110", Baud: 300, Bps: 300, Modulation: "AFSK", Protocol: "IL2Pc", Usage: "SSB", Bandwidth: "500Hz"},
+
+	{Mode: 0, DIP: "0000", Baud: 9600, Bps: 9600, Modulation: "GFSK", Protocol: "AX.25", Usage: "FM", Bandwidth: "25k", Legacy: true, SupersededBy: "9600 GFSK IL2Pc"},
+	{Mode: 4, DIP: "0100", Baud: 4800, Bps: 4800, Modulation: "GFSK", Protocol: "IL2Pc", Usage: "FM", Bandwidth: "12.5k", Legacy: true, SupersededBy: "9600 4FSK IL2Pc"},
+	{Mode: 7, DIP: "0111", Baud: 1200, Bps: 1200, Modulation: "AFSK", Protocol: "IL2P", Usage: "FM", Bandwidth: "12.5k", Legacy: true, SupersededBy: "4800 GFSK IL2Pc"},
+	{Mode: 6, DIP: "0110", Baud: 1200, Bps: 1200, Modulation: "AFSK", Protocol: "AX.25", Usage: "FM", Bandwidth: "12.5k", Legacy: true, SupersededBy: "1200 AFSK IL2P"},
+	{Mode: 12, DIP: "1100", Baud: 300, Bps: 300, Modulation: "AFSK", Protocol: "AX.25", Usage: "SSB", Bandwidth: "500Hz", Legacy: true, SupersededBy: "300 AFSK IL2P"},
+	{Mode: 13, DIP: "1101", Baud: 300, Bps: 300, Modulation: "AFSK", Protocol: "IL2P", Usage: "SSB", Bandwidth: "500Hz", Legacy: true, SupersededBy: "300 AFSK IL2Pc"},
+}
+
+// Modes returns a copy of the mode table, modern modes first.
+func Modes() []ModeInfo {
+	return append([]ModeInfo(nil), modes...)
+}
+
+// LookupMode returns the table entry for mode.
+func LookupMode(mode int) (ModeInfo, bool) {
+	for _, m := range modes {
+		if m.Mode == mode {
+			return m, true
+		}
+	}
+	return ModeInfo{}, false
+}
+
+// ValidateMode checks that mode is a documented base mode (0-14), before any
+// non-persistent offset is applied.
+func ValidateMode(mode int) error {
+	if _, ok := LookupMode(mode); ok {
+		return nil
+	}
+	valid := make([]int, 0, len(modes))
+	for _, m := range modes {
+		valid = append(valid, m.Mode)
+	}
+	sort.Ints(valid)
+	return fmt.Errorf("%w %d: valid modes are %v", ErrInvalidMode, mode, valid)
+}
+
+// LookupDIP returns the mode selected by a DIP switch pattern such as "0011".
+func LookupDIP(dip string) (ModeInfo, bool) {
+	for _, m := range modes {
+		if m.DIP == dip {
+			return m, true
+		}
+	}
+	return ModeInfo{}, false
+}
+
+// Name returns the mode's canonical name, such as "9600 4FSK IL2Pc". Names
+// are unique across the table.
+func (m ModeInfo) Name() string {
+	return fmt.Sprintf("%d %s %s", m.Bps, m.Modulation, m.Protocol)
+}
+
+// LookupModeName finds a mode by name, ignoring case and treating "-" and
+// "_" as spaces. Leading words of a name, such as "9600-4fsk", are accepted as
+// long as they match only one mode.
+func LookupModeName(name string) (ModeInfo, error) {
+	want := strings.Fields(strings.ToLower(strings.NewReplacer("-", " ", "_", " ").Replace(name)))
+	var matches []ModeInfo
+	for _, m := range modes {
+		words := strings.Fields(strings.ToLower(m.Name()))
+		if len(want) == 0 || len(want) > len(words) {
+			continue
+		}
+		if strings.Join(words[:len(want)], " ") == strings.Join(want, " ") {
+			if len(want) == len(words) {
+				return m, nil
+			}
+			matches = append(matches, m)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return ModeInfo{}, fmt.Errorf("unknown mode name %q: valid names are %s", name, quotedNames(modes))
+	default:
+		return ModeInfo{}, fmt.Errorf("mode name %q is ambiguous: could be %s", name, quotedNames(matches))
+	}
+}
+
+func quotedNames(ms []ModeInfo) string {
+	names := make([]string, len(ms))
+	for i, m := range ms {
+		names[i] = fmt.Sprintf("%q", m.Name())
+	}
+	return strings.Join(names, ", ")
+}
+
+// FindMode returns the single mode matching all the given criteria. baud
+// matches either the symbol rate or the bit rate; modulation and protocol are
+// compared ignoring case, and dots for protocol so AX25 matches AX.25. A zero
+// baud or empty string matches anything.
+func FindMode(baud int, modulation, protocol string) (ModeInfo, error) {
+	if baud == 0 && modulation == "" && protocol == "" {
+		return ModeInfo{}, errors.New("no baud rate, modulation or protocol given")
+	}
+	normProto := func(p string) string { return strings.ToLower(strings.ReplaceAll(p, ".", "")) }
+	var matches []ModeInfo
+	for _, m := range modes {
+		if baud != 0 && m.Baud != baud && m.Bps != baud {
+			continue
+		}
+		if modulation != "" && !strings.EqualFold(m.Modulation, modulation) {
+			continue
+		}
+		if protocol != "" && normProto(m.Protocol) != normProto(protocol) {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	var want []string
+	if baud != 0 {
+		want = append(want, strconv.Itoa(baud))
+	}
+	want = append(want, modulation, protocol)
+	desc := strings.Join(strings.Fields(strings.Join(want, " ")), " ")
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return ModeInfo{}, fmt.Errorf("no mode matches %q: valid modes are %s", desc, quotedNames(modes))
+	default:
+		return ModeInfo{}, fmt.Errorf("%q is ambiguous: could be %s", desc, quotedNames(matches))
+	}
+}
@@ -0,0 +1,69 @@
+package ninotnc
+
+import (
+	"fmt"
+	"testing"
+)
+
+// TestModeLookups checks each mode in the table is found again by its DIP
+// pattern and its name. Its frames are covered by TestSetModeFrame.
+func TestModeLookups(t *testing.T) {
+	for _, m := range Modes() {
+		if got, ok := LookupDIP(m.DIP); !ok || got.Mode != m.Mode {
+			t.Errorf("LookupDIP(%q) = %d, %v, want %d", m.DIP, got.Mode, ok, m.Mode)
+		}
+		if got, err := LookupModeName(m.Name()); err != nil || got.Mode != m.Mode {
+			t.Errorf("LookupModeName(%q) = %d, %v, want %d", m.Name(), got.Mode, err, m.Mode)
+		}
+	}
+}
+
+// TestModeTableConsistent checks the mode table has no duplicate mode
+// numbers, DIP patterns or names, that each DIP pattern is its mode in
+// binary, and that every legacy mode's SupersededBy names a mode in the
+// table which, followed through any further legacy modes, ends at a current
+// one.
+func TestModeTableConsistent(t *testing.T) {
+	byMode := map[int]ModeInfo{}
+	byDIP := map[string]int{}
+	byName := map[string]ModeInfo{}
+	for _, m := range modes {
+		if prev, ok := byMode[m.Mode]; ok {
+			t.Errorf("mode %d appears twice: %q and %q", m.Mode, prev.Name(), m.Name())
+		}
+		byMode[m.Mode] = m
+		if prev, ok := byDIP[m.DIP]; ok {
+			t.Errorf("DIP %s is used by modes %d and %d", m.DIP, prev, m.Mode)
+		}
+		byDIP[m.DIP] = m.Mode
+		if prev, ok := byName[m.Name()]; ok {
+			t.Errorf("name %q is used by modes %d and %d", m.Name(), prev.Mode, m.Mode)
+		}
+		byName[m.Name()] = m
+		if want := fmt.Sprintf("%04b", m.Mode); m.DIP != want {
+			t.Errorf("mode %d has DIP %s, want %s", m.Mode, m.DIP, want)
+		}
+	}
+	for _, m := range modes {
+		if !m.Legacy {
+			if m.SupersededBy != "" {
+				t.Errorf("current mode %d is superseded by %q", m.Mode, m.SupersededBy)
+			}
+			continue
+		}
+		seen := map[int]bool{m.Mode: true}
+		for cur := m; cur.Legacy; {
+			next, ok := byName[cur.SupersededBy]
+			if !ok {
+				t.Errorf("legacy mode %d is superseded by %q, which is not a mode name", cur.Mode, cur.SupersededBy)
+				break
+			}
+			if seen[next.Mode] {
+				t.Errorf("legacy mode %d's SupersededBy chain loops back to mode %d", m.Mode, next.Mode)
+				break
+			}
+			seen[next.Mode] = true
+			cur = next
+		}
+	}
+}
@@ -0,0 +1,122 @@
+//go:build linux
+
+package ninotnc
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// PTYKISSConnection talks KISS over a pseudo-terminal, so a mock TNC process
+// on the other end can stand in for hardware in tests and demos.
+type PTYKISSConnection struct {
+	f      *os.File
+	slave  *os.File // held open when we created the pair, see NewPTYKISSConnection
+	path   string
+	reader *frameReader
+}
+
+// NewPTYKISSConnection opens the PTY at path in raw mode. With an empty path
+// it creates a new pseudo-terminal pair instead and acts as the master; the
+// slave's path, which a mock TNC should open, is returned by Path.
+func NewPTYKISSConnection(path string) (*PTYKISSConnection, error) {
+	p, err := openPTY(path)
+	if err != nil {
+		return nil, withClass(ErrConnect, err)
+	}
+	return p, nil
+}
+
+func openPTY(path string) (*PTYKISSConnection, error) {
+	if path != "" {
+		f, err := openRaw(path)
+		if err != nil {
+			return nil, err
+		}
+		logger.Infof("Opened PTY %s", path)
+		return &PTYKISSConnection{f: f, path: path, reader: &frameReader{r: f}}, nil
+	}
+
+	fd, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: "/dev/ptmx", Err: err}
+	}
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("unlocking PTY: %w", err)
+	}
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("getting PTY number: %w", err)
+	}
+	master := os.NewFile(uintptr(fd), "/dev/ptmx")
+	slavePath := fmt.Sprintf("/dev/pts/%d", n)
+	// Keep our own handle on the slave: it holds the raw settings in place
+	// and stops master reads failing with EIO before the peer has opened it.
+	slave, err := openRaw(slavePath)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+	logger.Infof("Created PTY pair, peer should open %s", slavePath)
+	return &PTYKISSConnection{f: master, slave: slave, path: slavePath, reader: &frameReader{r: master}}, nil
+}
+
+// openRaw opens a terminal device and switches off all line discipline
+// processing so KISS bytes pass through unchanged. The descriptor is opened
+// non-blocking so the resulting file supports read deadlines.
+func openRaw(path string) (*os.File, error) {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: path, Err: err}
+	}
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("%s is not a terminal: %w", path, err)
+	}
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB
+	t.Cflag |= unix.CS8
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, t); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("setting raw mode on %s: %w", path, err)
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+// Path is the PTY device the peer should use: the one opened, or the slave
+// side of a newly created pair.
+func (p *PTYKISSConnection) Path() string {
+	return p.path
+}
+
+func (p *PTYKISSConnection) Write(b []byte) (int, error) {
+	return writeFull(p.f, b)
+}
+
+func (p *PTYKISSConnection) Read(b []byte) (int, error) {
+	if n := p.reader.buffered(b); n > 0 {
+		return n, nil
+	}
+	return p.f.Read(b)
+}
+
+func (p *PTYKISSConnection) ReadFrame(timeout time.Duration) ([]byte, error) {
+	return readFrameDeadline(p.f, p.reader, timeout)
+}
+
+func (p *PTYKISSConnection) Close() error {
+	if p.slave != nil {
+		p.slave.Close()
+	}
+	return p.f.Close()
+}
@@ -0,0 +1,75 @@
+package ninotnc
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// mockTNC stands in for a NinoTNC on the far side of a PTY: it records each
+// frame it receives and answers each with ack.
+type mockTNC struct {
+	f      *os.File
+	frames chan []byte
+}
+
+func startMockTNC(t *testing.T, path string, ack []byte) *mockTNC {
+	t.Helper()
+	f, err := openRaw(path)
+	if err != nil {
+		t.Fatalf("opening the PTY peer %s: %v", path, err)
+	}
+	m := &mockTNC{f: f, frames: make(chan []byte, 16)}
+	t.Cleanup(func() { f.Close() })
+	go func() {
+		fr := &frameReader{r: f}
+		for {
+			frame, err := fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			m.frames <- frame
+			if _, err := writeFull(f, ack); err != nil {
+				return
+			}
+		}
+	}()
+	return m
+}
+
+func TestPTYMockTNC(t *testing.T) {
+	conn, err := NewPTYKISSConnection("")
+	if err != nil {
+		t.Skipf("cannot create a PTY pair: %v", err)
+	}
+	defer conn.Close()
+	// Acknowledge with a different mode than the one asked for, as a TNC
+	// left in another mode by its DIP switches would, so the result shows
+	// the reply came from the mock and was not just an echo.
+	ack := BuildKISSFrameCmd(KISS_CMD_SETHW, []byte{0x12})
+	mock := startMockTNC(t, conn.Path(), ack)
+
+	res, err := SetModeWithOptions(context.Background(), conn, 3, false, SetModeOptions{AckTimeout: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("SetModeWithOptions: %v", err)
+	}
+	select {
+	case frame := <-mock.frames:
+		if !bytes.Equal(frame, []byte{KISS_CMD_SETHW, 0x13}) {
+			t.Errorf("mock TNC received % X, want 06 13", frame)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("mock TNC received nothing")
+	}
+	if !res.Acknowledged() {
+		t.Fatalf("no acknowledgement: %v", res.AckErr)
+	}
+	if !bytes.Equal(res.Response, []byte{KISS_CMD_SETHW, 0x12}) {
+		t.Errorf("Response = % X, want the configured ack 06 12", res.Response)
+	}
+	if res.EffectiveMode != 2 {
+		t.Errorf("EffectiveMode = %d, want 2 from the ack", res.EffectiveMode)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !linux
+
+package ninotnc
+
+import (
+	"errors"
+	"time"
+)
+
+// PTYKISSConnection talks KISS over a pseudo-terminal. It is only available
+// on Linux.
+type PTYKISSConnection struct{}
+
+// NewPTYKISSConnection always fails on this platform.
+func NewPTYKISSConnection(path string) (*PTYKISSConnection, error) {
+	return nil, errors.New("PTY connections are only supported on Linux")
+}
+
+func (p *PTYKISSConnection) Path() string {
+	return ""
+}
+
+func (p *PTYKISSConnection) Write(b []byte) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func (p *PTYKISSConnection) Read(b []byte) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func (p *PTYKISSConnection) ReadFrame(timeout time.Duration) ([]byte, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (p *PTYKISSConnection) Close() error {
+	return nil
+}
@@ -0,0 +1,182 @@
+package ninotnc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrClosed is returned by a ReconnectingConnection used after Close.
+var ErrClosed = errors.New("connection closed")
+
+// ReconnectingConnection wraps a KISSConnection and, when a write fails
+// because the connection was lost, dials a fresh connection and writes
+// again, so long-running users survive a TNC server restart or a USB
+// re-enumeration. Other write errors, such as a frame the transport
+// rejects, are returned as they are, since a new connection would fail the
+// same way.
+type ReconnectingConnection struct {
+	ctx        context.Context
+	dial       func() (KISSConnection, error)
+	maxRetries int
+	backoff    time.Duration
+	// done is closed by Close, cutting short a backoff wait.
+	done chan struct{}
+
+	// writeMu serialises writes; mu guards conn and closed, and is never
+	// held during I/O so Close can abort a blocked write.
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	conn    KISSConnection
+	closed  bool
+}
+
+// NewReconnectingConnection dials a first connection with dial. A failed
+// write is retried on up to maxRetries new connections, waiting backoff
+// before the first reconnect and doubling the wait after each further one.
+func NewReconnectingConnection(dial func() (KISSConnection, error), maxRetries int, backoff time.Duration) (*ReconnectingConnection, error) {
+	return NewReconnectingConnectionContext(context.Background(), dial, maxRetries, backoff)
+}
+
+// NewReconnectingConnectionContext is like NewReconnectingConnection but
+// gives up reconnecting, and returns ctx's error from Write, once ctx is done.
+func NewReconnectingConnectionContext(ctx context.Context, dial func() (KISSConnection, error), maxRetries int, backoff time.Duration) (*ReconnectingConnection, error) {
+	conn, err := dial()
+	if err != nil {
+		return nil, err
+	}
+	return &ReconnectingConnection{ctx: ctx, dial: dial, maxRetries: maxRetries, backoff: backoff, done: make(chan struct{}), conn: conn}, nil
+}
+
+func (r *ReconnectingConnection) Write(b []byte) (int, error) {
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+	conn, err := r.current()
+	if err != nil {
+		return 0, err
+	}
+	n, err := conn.Write(b)
+	if err == nil || !connectionLost(err) {
+		return n, err
+	}
+	delay := r.backoff
+	for attempt := 1; attempt <= r.maxRetries; attempt++ {
+		if r.isClosed() {
+			return 0, ErrClosed
+		}
+		logger.Warnf("Write failed (%v), reconnecting (attempt %d of %d)", err, attempt, r.maxRetries)
+		conn.Close()
+		select {
+		case <-r.ctx.Done():
+			return 0, r.ctx.Err()
+		case <-r.done:
+			return 0, ErrClosed
+		case <-time.After(delay):
+		}
+		delay *= 2
+		next, dialErr := r.dial()
+		if dialErr != nil {
+			err = dialErr
+			continue
+		}
+		r.mu.Lock()
+		if r.closed {
+			r.mu.Unlock()
+			next.Close()
+			return 0, ErrClosed
+		}
+		r.conn = next
+		r.mu.Unlock()
+		conn = next
+		logger.Infof("Reconnected")
+		if n, err = conn.Write(b); err == nil {
+			return n, nil
+		}
+		if !connectionLost(err) {
+			return n, err
+		}
+	}
+	return 0, fmt.Errorf("write failed after %d reconnects: %w", r.maxRetries, err)
+}
+
+// connectionLost reports whether err, from a write, is an I/O failure that
+// a fresh connection may cure: the connection was closed or reset, the far
+// end went away, the serial device vanished or a write stalled.
+func connectionLost(err error) bool {
+	var (
+		opErr   *net.OpError
+		pathErr *os.PathError
+		sysErr  *os.SyscallError
+		errno   syscall.Errno
+	)
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.ErrShortWrite) || errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, net.ErrClosed) || errors.Is(err, ErrWrite) ||
+		errors.As(err, &opErr) || errors.As(err, &pathErr) ||
+		errors.As(err, &sysErr) || errors.As(err, &errno)
+}
+
+// current returns the live connection, or ErrClosed after Close.
+func (r *ReconnectingConnection) current() (KISSConnection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, ErrClosed
+	}
+	return r.conn, nil
+}
+
+func (r *ReconnectingConnection) isClosed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.closed
+}
+
+// Read reads from the current connection. Only writes reconnect.
+func (r *ReconnectingConnection) Read(b []byte) (int, error) {
+	conn, err := r.current()
+	if err != nil {
+		return 0, err
+	}
+	return conn.Read(b)
+}
+
+func (r *ReconnectingConnection) ReadFrame(timeout time.Duration) ([]byte, error) {
+	conn, err := r.current()
+	if err != nil {
+		return nil, err
+	}
+	return conn.ReadFrame(timeout)
+}
+
+// Drain passes through to connections that buffer output.
+func (r *ReconnectingConnection) Drain() error {
+	conn, err := r.current()
+	if err != nil {
+		return err
+	}
+	if d, ok := conn.(interface{ Drain() error }); ok {
+		return d.Drain()
+	}
+	return nil
+}
+
+// Close closes the current connection and stops further reconnects.
+func (r *ReconnectingConnection) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	conn := r.conn
+	r.mu.Unlock()
+	return conn.Close()
+}
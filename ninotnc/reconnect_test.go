@@ -0,0 +1,123 @@
+package ninotnc_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+	"github.com/madpsy/ninotnc-set-mode/ninotnc/kisstest"
+)
+
+// failingDial returns a connection that is already closed, so every write
+// on it fails and the ReconnectingConnection goes into its backoff.
+func failingDial() (ninotnc.KISSConnection, error) {
+	conn := kisstest.New()
+	conn.Close()
+	return conn, nil
+}
+
+func TestReconnectBackoffEndsOnClose(t *testing.T) {
+	rc, err := ninotnc.NewReconnectingConnection(failingDial, 3, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := rc.Write([]byte{ninotnc.KISS_FLAG, ninotnc.KISS_CMD_SETHW, 0x13, ninotnc.KISS_FLAG})
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	rc.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ninotnc.ErrClosed) {
+			t.Errorf("Write = %v, want ErrClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Write still waiting out the backoff after Close")
+	}
+}
+
+func TestReconnectBackoffEndsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rc, err := ninotnc.NewReconnectingConnectionContext(ctx, failingDial, 3, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	done := make(chan error, 1)
+	go func() {
+		_, err := rc.Write([]byte{ninotnc.KISS_FLAG, ninotnc.KISS_CMD_SETHW, 0x13, ninotnc.KISS_FLAG})
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Write = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Write still waiting out the backoff after cancel")
+	}
+}
+
+func TestReconnectAfterWriteFailure(t *testing.T) {
+	first := kisstest.New()
+	first.Close()
+	second := kisstest.New()
+	conns := []*kisstest.Conn{first, second}
+	dials := 0
+	dial := func() (ninotnc.KISSConnection, error) {
+		if dials >= len(conns) {
+			t.Fatalf("dialed %d times, want %d", dials+1, len(conns))
+		}
+		dials++
+		return conns[dials-1], nil
+	}
+	rc, err := ninotnc.NewReconnectingConnection(dial, 3, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	frame := []byte{ninotnc.KISS_FLAG, ninotnc.KISS_CMD_SETHW, 0x13, ninotnc.KISS_FLAG}
+	if n, err := rc.Write(frame); err != nil || n != len(frame) {
+		t.Fatalf("Write = %d, %v, want %d, nil", n, err, len(frame))
+	}
+	if dials != 2 {
+		t.Errorf("dialed %d times, want 2", dials)
+	}
+	if got := second.Frames(); len(got) != 1 || !bytes.Equal(got[0], frame) {
+		t.Errorf("second connection got % X, want the frame", got)
+	}
+}
+
+// rejectingConn fails every write with an error that is not a lost
+// connection, as a transport refusing a malformed frame does.
+type rejectingConn struct{ *kisstest.Conn }
+
+var errRejected = errors.New("frame rejected")
+
+func (rejectingConn) Write([]byte) (int, error) { return 0, errRejected }
+
+func TestReconnectSkipsPermanentErrors(t *testing.T) {
+	dials := 0
+	rc, err := ninotnc.NewReconnectingConnection(func() (ninotnc.KISSConnection, error) {
+		dials++
+		return rejectingConn{kisstest.New()}, nil
+	}, 3, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	if _, err := rc.Write([]byte{ninotnc.KISS_FLAG, ninotnc.KISS_CMD_SETHW, 0x13, ninotnc.KISS_FLAG}); !errors.Is(err, errRejected) {
+		t.Errorf("Write = %v, want the rejection returned as is", err)
+	}
+	if dials != 1 {
+		t.Errorf("dialed %d times, want 1: a rejected frame is not a lost connection", dials)
+	}
+}
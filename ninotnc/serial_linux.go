@@ -0,0 +1,25 @@
+//go:build linux
+
+package ninotnc
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// enableRTSCTS turns on hardware flow control for the serial device at path,
+// which the serial library cannot do itself. Terminal settings belong to the
+// device rather than the descriptor, so setting them through a second
+// descriptor applies to the port already opened.
+func enableRTSCTS(path string) error {
+	fd, err := unix.Open(path, unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	t, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+	t.Cflag |= unix.CRTSCTS
+	return unix.IoctlSetTermios(fd, unix.TCSETS, t)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package ninotnc
+
+import "errors"
+
+// enableRTSCTS is only implemented on Linux; the serial library has no
+// portable way to enable hardware flow control.
+func enableRTSCTS(path string) error {
+	return errors.New("RTS/CTS flow control is only supported on Linux")
+}
@@ -0,0 +1,314 @@
+package ninotnc
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// MinFirmwareVersion is the oldest NinoTNC firmware that accepts the set-mode
+// command.
+const MinFirmwareVersion = 41
+
+// FirmwareUpgradeURL is where NinoTNC firmware and flashing instructions are
+// published.
+const FirmwareUpgradeURL = "https://wiki.oarc.uk/packet:ninotnc"
+
+// firmwareMatrix records, per firmware version, the changes to the set-mode
+// command this package depends on. Versions before MinFirmwareVersion ignore
+// the command entirely. No later release is known to change the command byte
+// or the +16 offset, so frame construction does not branch on version yet;
+// add an entry here, and a branch in SetModeFrame, if one does.
+var firmwareMatrix = map[int]string{
+	41: "accepts the KISS set-mode (SETHW, 0x06) command; the mode plus 16 applies a mode without storing it",
+}
+
+// FirmwareNotes lists the firmwareMatrix entries, oldest first, as lines such
+// as "v41: ...".
+func FirmwareNotes() []string {
+	versions := make([]int, 0, len(firmwareMatrix))
+	for v := range firmwareMatrix {
+		versions = append(versions, v)
+	}
+	sort.Ints(versions)
+	notes := make([]string, len(versions))
+	for i, v := range versions {
+		notes[i] = fmt.Sprintf("v%d: %s", v, firmwareMatrix[v])
+	}
+	return notes
+}
+
+// CheckFirmware reports whether firmware version v supports the set-mode
+// command. Zero means the version is unknown and is not checked.
+func CheckFirmware(v int) error {
+	if v == 0 || v >= MinFirmwareVersion {
+		return nil
+	}
+	return fmt.Errorf("firmware v%d does not support setting the mode over KISS: upgrade to v%d or later, see %s", v, MinFirmwareVersion, FirmwareUpgradeURL)
+}
+
+// SetMode sends the set-mode command for mode over conn. When write is false
+// the mode is applied without being stored, which the firmware signals by
+// adding 16 to the mode byte.
+func SetMode(conn KISSConnection, mode int, write bool) (SetModeResult, error) {
+	return SetModeContext(context.Background(), conn, mode, write)
+}
+
+// SetModeContext is like SetMode but gives up once ctx is done. A write that
+// is blocked when ctx is canceled is aborted by closing conn.
+func SetModeContext(ctx context.Context, conn KISSConnection, mode int, write bool) (SetModeResult, error) {
+	return SetModeWithOptions(ctx, conn, mode, write, SetModeOptions{})
+}
+
+// SetModeOptions adjusts how the set-mode command is framed. The zero value
+// matches a stock single-port NinoTNC.
+type SetModeOptions struct {
+	// KISSPort (0-15) is placed in the high nibble of the command byte. Most
+	// single-port NinoTNC users should leave it at 0.
+	KISSPort int
+	// AckTimeout, when positive, makes SetModeWithOptions wait this long for
+	// the TNC to acknowledge the command.
+	AckTimeout time.Duration
+	// Firmware is the TNC's firmware version, if known. Versions below
+	// MinFirmwareVersion are refused; zero skips the check.
+	Firmware int
+	// NoOffset sends the mode byte without the +16 offset even when write is
+	// false. The firmware stores any mode sent without the offset, so this
+	// persists the mode just as write does.
+	NoOffset bool
+	// Command is the set-mode opcode, for firmware forks that use another
+	// one; zero means KISS_CMD_SETHW. With a non-zero KISSPort it must fit
+	// in the low nibble.
+	Command byte
+}
+
+// SetModeResult describes a set-mode command that was sent.
+type SetModeResult struct {
+	// RequestedMode is the mode asked for.
+	RequestedMode int
+	// EffectiveMode is the mode the TNC reported in its acknowledgement. It
+	// equals RequestedMode when there was no acknowledgement to go on.
+	EffectiveMode int
+	// Persisted reports whether the mode byte asks the TNC to store the mode
+	// in memory, which it does for any byte without the +16 offset.
+	Persisted bool
+	// ModeByte is the mode value sent, including the +16 non-persistent
+	// offset.
+	ModeByte byte
+	// Frame is the complete KISS frame sent.
+	Frame []byte
+	// Response is the acknowledgement frame, nil if none arrived.
+	Response []byte
+	// BytesSent is how many bytes of Frame were written.
+	BytesSent int
+	// SentAt is when the write started.
+	SentAt time.Time
+	// RoundTrip is the time from the start of the write to the
+	// acknowledgement, zero without one.
+	RoundTrip time.Duration
+	// AckErr is why no acknowledgement was received when one was waited
+	// for. A missing acknowledgement does not mean the command failed, so it
+	// is reported here rather than as an error.
+	AckErr error
+}
+
+// Acknowledged reports whether the TNC acknowledged the command.
+func (r SetModeResult) Acknowledged() bool {
+	return r.Response != nil
+}
+
+// modeByte returns the mode value sent for mode, adding the non-persistent
+// offset unless write or opts.NoOffset is set. ValidateMode keeps modes far
+// below the limit, but the range is checked here too so a value can never
+// wrap around into a different, valid-looking command.
+func modeByte(mode int, write bool, opts SetModeOptions) (byte, error) {
+	v := mode
+	if !write && !opts.NoOffset {
+		v += 16
+	}
+	if v < 0 || v > 0xFF {
+		return 0, withClass(ErrInvalidMode, fmt.Errorf("mode %d gives mode byte %d, outside 0-255", mode, v))
+	}
+	return byte(v), nil
+}
+
+// SetModeFrame builds the KISS frame that SetModeWithOptions would send,
+// without performing any I/O.
+func SetModeFrame(mode int, write bool, opts SetModeOptions) ([]byte, error) {
+	if err := ValidateMode(mode); err != nil {
+		return nil, err
+	}
+	if opts.KISSPort < 0 || opts.KISSPort > 15 {
+		return nil, withClass(ErrInvalidOptions, fmt.Errorf("invalid KISS port %d: must be 0-15", opts.KISSPort))
+	}
+	if err := CheckFirmware(opts.Firmware); err != nil {
+		return nil, withClass(ErrInvalidOptions, err)
+	}
+
+	b, err := modeByte(mode, write, opts)
+	if err != nil {
+		return nil, err
+	}
+	opcode := cmp.Or(opts.Command, KISS_CMD_SETHW)
+	if opts.KISSPort != 0 && opcode > 0x0F {
+		return nil, withClass(ErrInvalidOptions, fmt.Errorf("command %02X does not fit beside KISS port %d: must be 01-0F", opcode, opts.KISSPort))
+	}
+	cmd := byte(opts.KISSPort<<4) | opcode
+	return BuildKISSFrameCmd(cmd, []byte{b}), nil
+}
+
+// BuildSetModeFrame builds the frame SetMode sends to a stock single-port
+// NinoTNC and its FrameHex form, with no I/O, for front-ends that display
+// the frame or send it some other way.
+func BuildSetModeFrame(mode int, write bool) (frame []byte, hex string, err error) {
+	frame, err = SetModeFrame(mode, write, SetModeOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	return frame, FrameHex(frame), nil
+}
+
+// SetModeWithOptions is like SetModeContext with non-default framing, and
+// waits for the acknowledgement when opts.AckTimeout is set.
+func SetModeWithOptions(ctx context.Context, conn KISSConnection, mode int, write bool, opts SetModeOptions) (SetModeResult, error) {
+	packet, err := SetModeFrame(mode, write, opts)
+	if err != nil {
+		return SetModeResult{}, err
+	}
+	// SetModeFrame has already checked the range.
+	b, _ := modeByte(mode, write, opts)
+	res := SetModeResult{
+		RequestedMode: mode,
+		EffectiveMode: mode,
+		Persisted:     b < 16,
+		ModeByte:      b,
+		Frame:         packet,
+	}
+	if err := ctx.Err(); err != nil {
+		return res, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	res.SentAt = time.Now()
+	n, err := conn.Write(packet)
+	stop()
+	res.BytesSent = n
+	// The built-in transports never write short without an error, but
+	// other KISSConnection implementations might.
+	if err == nil && n < len(packet) {
+		err = io.ErrShortWrite
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return res, ctxErr
+	}
+	if err != nil {
+		return res, withClass(ErrWrite, fmt.Errorf("sending mode command: %w", err))
+	}
+
+	if res.Persisted {
+		logger.Infof("Sent KISS packet to set mode to %d (%d)", mode, mode)
+	} else {
+		logger.Infof("Sent KISS packet to set mode to %d (%d + 16)", mode+16, mode)
+	}
+
+	if opts.AckTimeout <= 0 {
+		return res, nil
+	}
+	response, err := WaitForAckContext(ctx, conn, cmp.Or(opts.Command, KISS_CMD_SETHW), opts.AckTimeout)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return res, ctxErr
+	}
+	if err != nil {
+		res.AckErr = err
+		return res, nil
+	}
+	res.Response = response
+	res.RoundTrip = time.Since(res.SentAt)
+	if reported, err := ReportedMode(response); err == nil {
+		res.EffectiveMode = reported.Mode
+	}
+	return res, nil
+}
+
+// ackMatches reports whether got, the command byte of a received frame,
+// answers a command sent with opcode cmd, as WaitForAck describes.
+func ackMatches(got, cmd byte) bool {
+	if cmd <= 0x0F {
+		return got&0x0F == cmd
+	}
+	return got == cmd
+}
+
+// WaitForAck reads frames until one carrying cmd arrives or timeout elapses.
+// An opcode that fits in the low nibble, such as KISS_CMD_SETHW, matches
+// whatever KISS port is in the reply's high nibble; a wider one, such as
+// 0x20, must match exactly, as its low nibble is the data frame opcode 0.
+// Unrelated frames, such as received packets, and frames longer than
+// MaxFrameLen are logged and skipped.
+func WaitForAck(conn KISSConnection, cmd byte, timeout time.Duration) ([]byte, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, ErrTimeout
+		}
+		frame, err := conn.ReadFrame(remaining)
+		if errors.Is(err, ErrFrameTooLong) {
+			logger.Debugf("Ignoring oversized KISS frame")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ackMatches(frame[0], cmd) {
+			return frame, nil
+		}
+		logger.Debugf("Ignoring KISS frame: % X", frame)
+	}
+}
+
+// WaitForAckContext is like WaitForAck but returns ctx's error as soon as ctx
+// is done, closing conn to abort the pending read.
+func WaitForAckContext(ctx context.Context, conn KISSConnection, cmd byte, timeout time.Duration) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	frame, err := WaitForAck(conn, cmd, timeout)
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	return frame, err
+}
+
+// QueryMode waits for the TNC to report its current mode in a set-mode frame
+// and returns the matching table entry. The firmware (v41 or later) has no
+// documented query command, so this only listens for status frames the TNC
+// emits on its own, for example on connect or after a mode change.
+func QueryMode(ctx context.Context, conn KISSConnection, timeout time.Duration) (ModeInfo, error) {
+	frame, err := WaitForAckContext(ctx, conn, KISS_CMD_SETHW, timeout)
+	if err != nil {
+		return ModeInfo{}, err
+	}
+	return ReportedMode(frame)
+}
+
+// ReportedMode decodes the mode from a set-mode frame received from the TNC,
+// such as an acknowledgement or a status report, ignoring the non-persistent
+// offset.
+func ReportedMode(frame []byte) (ModeInfo, error) {
+	if len(frame) < 2 {
+		return ModeInfo{}, fmt.Errorf("mode report % X has no mode byte", frame)
+	}
+	// Strip the non-persistent offset; the mode lives in the low nibble.
+	mode := int(frame[1] & 0x0F)
+	m, ok := LookupMode(mode)
+	if !ok {
+		return ModeInfo{}, fmt.Errorf("TNC reported unknown mode %d", mode)
+	}
+	return m, nil
+}
@@ -0,0 +1,201 @@
+package ninotnc
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// goldenFrames is the exact wire form of set-mode frames, written out by
+// hand: every mode a stock single-port NinoTNC is sent, with and without
+// -write, then the KISS port, opcode and offset variants, including those
+// whose command or mode byte is FEND or FESC and must be escaped. Rows with
+// a mode outside the table cannot come from SetModeFrame, which refuses
+// them; they pin how modeByte's result is framed.
+var goldenFrames = []struct {
+	name  string
+	mode  int
+	write bool
+	opts  SetModeOptions
+	frame []byte
+}{
+	{"", 0, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x10, 0xC0}},
+	{"", 0, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x00, 0xC0}},
+	{"", 1, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x11, 0xC0}},
+	{"", 1, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x01, 0xC0}},
+	{"", 2, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x12, 0xC0}},
+	{"", 2, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x02, 0xC0}},
+	{"", 3, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x13, 0xC0}},
+	{"", 3, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x03, 0xC0}},
+	{"", 4, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x14, 0xC0}},
+	{"", 4, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x04, 0xC0}},
+	{"", 5, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x15, 0xC0}},
+	{"", 5, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x05, 0xC0}},
+	{"", 6, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x16, 0xC0}},
+	{"", 6, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x06, 0xC0}},
+	{"", 7, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x17, 0xC0}},
+	{"", 7, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x07, 0xC0}},
+	{"", 8, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x18, 0xC0}},
+	{"", 8, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x08, 0xC0}},
+	{"", 9, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x19, 0xC0}},
+	{"", 9, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x09, 0xC0}},
+	{"", 10, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x1A, 0xC0}},
+	{"", 10, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x0A, 0xC0}},
+	{"", 11, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x1B, 0xC0}},
+	{"", 11, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x0B, 0xC0}},
+	{"", 12, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x1C, 0xC0}},
+	{"", 12, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x0C, 0xC0}},
+	{"", 13, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x1D, 0xC0}},
+	{"", 13, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x0D, 0xC0}},
+	{"", 14, false, SetModeOptions{}, []byte{0xC0, 0x06, 0x1E, 0xC0}},
+	{"", 14, true, SetModeOptions{}, []byte{0xC0, 0x06, 0x0E, 0xC0}},
+	{"no offset", 3, false, SetModeOptions{NoOffset: true}, []byte{0xC0, 0x06, 0x03, 0xC0}},
+	{"KISS port 2", 3, false, SetModeOptions{KISSPort: 2}, []byte{0xC0, 0x26, 0x13, 0xC0}},
+	{"KISS port 15", 3, true, SetModeOptions{KISSPort: 15}, []byte{0xC0, 0xF6, 0x03, 0xC0}},
+	{"other opcode", 3, false, SetModeOptions{Command: 0x0E}, []byte{0xC0, 0x0E, 0x13, 0xC0}},
+	{"command byte FESC", 3, false, SetModeOptions{KISSPort: 13, Command: 0x0B}, []byte{0xC0, 0xDB, 0xDD, 0x13, 0xC0}},
+	{"command byte FEND", 3, true, SetModeOptions{Command: 0xC0}, []byte{0xC0, 0xDB, 0xDC, 0x03, 0xC0}},
+	{"mode byte FEND", 0xC0, false, SetModeOptions{NoOffset: true}, []byte{0xC0, 0x06, 0xDB, 0xDC, 0xC0}},
+	{"mode byte FESC", 0xDB, false, SetModeOptions{NoOffset: true}, []byte{0xC0, 0x06, 0xDB, 0xDD, 0xC0}},
+	{"mode byte FESC after offset", 0xCB, false, SetModeOptions{}, []byte{0xC0, 0x06, 0xDB, 0xDD, 0xC0}},
+}
+
+// TestSetModeFrame checks every golden frame, and that each frame carries the
+// command byte followed by exactly one payload byte, the mode byte, which
+// the firmware relies on. Every entry in the mode table must have a stock
+// row with and without write, so a new mode cannot ship without one.
+func TestSetModeFrame(t *testing.T) {
+	if KISS_CMD_SETHW != 0x06 {
+		t.Fatalf("KISS_CMD_SETHW = %02X, want 06", KISS_CMD_SETHW)
+	}
+	stock := map[[2]int]bool{}
+	for _, g := range goldenFrames {
+		name := g.name
+		if name == "" {
+			name = "stock"
+			w := 0
+			if g.write {
+				w = 1
+			}
+			stock[[2]int{g.mode, w}] = true
+		}
+		t.Run(fmt.Sprintf("%s mode %d write=%v", name, g.mode, g.write), func(t *testing.T) {
+			b, err := modeByte(g.mode, g.write, g.opts)
+			if err != nil {
+				t.Fatalf("modeByte: %v", err)
+			}
+			cmd := byte(g.opts.KISSPort<<4) | cmp.Or(g.opts.Command, KISS_CMD_SETHW)
+			if _, ok := LookupMode(g.mode); !ok {
+				if _, err := SetModeFrame(g.mode, g.write, g.opts); !errors.Is(err, ErrInvalidMode) {
+					t.Errorf("SetModeFrame accepted mode %d outside the table: %v", g.mode, err)
+				}
+				if frame := BuildKISSFrameCmd(cmd, []byte{b}); !bytes.Equal(frame, g.frame) {
+					t.Errorf("mode byte %02X framed as % X, want % X", b, frame, g.frame)
+				}
+				return
+			}
+			frame, err := SetModeFrame(g.mode, g.write, g.opts)
+			if err != nil {
+				t.Fatalf("SetModeFrame: %v", err)
+			}
+			if !bytes.Equal(frame, g.frame) {
+				t.Errorf("SetModeFrame = % X, want % X", frame, g.frame)
+			}
+			gotCmd, payload, err := parseKISSFrame(frame)
+			if err != nil {
+				t.Fatalf("parseKISSFrame(% X): %v", frame, err)
+			}
+			if gotCmd != cmd || !bytes.Equal(payload, []byte{b}) {
+				t.Errorf("frame carries command %02X payload % X, want %02X and the single mode byte %02X", gotCmd, payload, cmd, b)
+			}
+			if g.opts == (SetModeOptions{}) {
+				built, hex, err := BuildSetModeFrame(g.mode, g.write)
+				if err != nil {
+					t.Fatalf("BuildSetModeFrame: %v", err)
+				}
+				if !bytes.Equal(built, g.frame) || hex != FrameHex(g.frame) {
+					t.Errorf("BuildSetModeFrame = % X %q, want % X %q", built, hex, g.frame, FrameHex(g.frame))
+				}
+			}
+		})
+	}
+	for _, m := range Modes() {
+		for w, write := range []bool{false, true} {
+			if !stock[[2]int{m.Mode, w}] {
+				t.Errorf("no stock goldenFrames row for mode %d write=%v", m.Mode, write)
+			}
+		}
+	}
+}
+
+func TestModeByte(t *testing.T) {
+	tests := []struct {
+		mode    int
+		write   bool
+		opts    SetModeOptions
+		want    byte
+		wantErr bool
+	}{
+		{0, false, SetModeOptions{}, 16, false},
+		{0, true, SetModeOptions{}, 0, false},
+		{15, false, SetModeOptions{}, 31, false},
+		{15, true, SetModeOptions{}, 15, false},
+		{16, true, SetModeOptions{}, 16, false},
+		{0, false, SetModeOptions{NoOffset: true}, 0, false},
+		{239, false, SetModeOptions{}, 0xFF, false},
+		{240, false, SetModeOptions{}, 0, true},
+		{255, true, SetModeOptions{}, 0xFF, false},
+		{256, true, SetModeOptions{}, 0, true},
+		{-1, true, SetModeOptions{}, 0, true},
+		{-17, false, SetModeOptions{}, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := modeByte(tt.mode, tt.write, tt.opts)
+		if tt.wantErr {
+			if !errors.Is(err, ErrInvalidMode) {
+				t.Errorf("modeByte(%d, %v, %+v) = %d, %v, want ErrInvalidMode", tt.mode, tt.write, tt.opts, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("modeByte(%d, %v, %+v) = %d, %v, want %d", tt.mode, tt.write, tt.opts, got, err, tt.want)
+		}
+	}
+}
+
+// TestSetModeFrameInvalidMode checks modes outside the table are refused
+// before any frame is built, whichever side of the +16 offset they fall.
+func TestSetModeFrameInvalidMode(t *testing.T) {
+	for _, mode := range []int{-1, 15, 16, 31, 99, 240, 256} {
+		for _, write := range []bool{false, true} {
+			if frame, err := SetModeFrame(mode, write, SetModeOptions{}); !errors.Is(err, ErrInvalidMode) {
+				t.Errorf("SetModeFrame(%d, %v) = % X, %v, want ErrInvalidMode", mode, write, frame, err)
+			}
+		}
+	}
+}
+
+func TestAckMatches(t *testing.T) {
+	tests := []struct {
+		got, cmd byte
+		want     bool
+	}{
+		{0x06, KISS_CMD_SETHW, true},
+		{0x26, KISS_CMD_SETHW, true},
+		{0x00, KISS_CMD_SETHW, false},
+		{0x16, 0x06, true},
+		{0x20, 0x20, true},
+		{0x00, 0x20, false},
+		{0x10, 0x20, false},
+		{0x00, 0x10, false},
+		{0xDB, 0xDB, true},
+		{0x0B, 0xDB, false},
+	}
+	for _, tt := range tests {
+		if got := ackMatches(tt.got, tt.cmd); got != tt.want {
+			t.Errorf("ackMatches(%02X, %02X) = %v, want %v", tt.got, tt.cmd, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// pacer enforces -min-interval: a minimum gap between consecutive frames
+// written on any connection during the run, for slow serial buffers that
+// corrupt bursts of commands.
+type pacer struct {
+	ctx      context.Context
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait sleeps until interval has passed since the previous frame, returning
+// early with the context's error if it is canceled.
+func (p *pacer) wait() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if d := time.Until(p.next); d > 0 {
+		logger.Debugf("Waiting %v for -min-interval", d.Round(time.Millisecond))
+		select {
+		case <-p.ctx.Done():
+			return p.ctx.Err()
+		case <-time.After(d):
+		}
+	}
+	p.next = time.Now().Add(p.interval)
+	return nil
+}
+
+// pacedConn delays each Write until its pacer allows it.
+type pacedConn struct {
+	ninotnc.KISSConnection
+	p *pacer
+}
+
+func (c pacedConn) Write(b []byte) (int, error) {
+	if err := c.p.wait(); err != nil {
+		return 0, err
+	}
+	return c.KISSConnection.Write(b)
+}
+
+// Drain passes through to connections that buffer output.
+func (c pacedConn) Drain() error {
+	if dr, ok := c.KISSConnection.(interface{ Drain() error }); ok {
+		return dr.Drain()
+	}
+	return nil
+}
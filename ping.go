@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// pingResult is the object printed to stdout for each device with -ping
+// -json.
+type pingResult struct {
+	Label     string `json:"label,omitempty"`
+	Target    string `json:"target"`
+	Reachable bool   `json:"reachable"`
+	Frame     string `json:"frame,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// runPing opens and closes a connection to each device without sending
+// anything, optionally listening for a status frame first, and prints
+// whether each was reachable. It fails with exitConnect if any was not.
+func runPing(ctx context.Context, o *options, devices []string, labels map[string]string, connect func(string) (ninotnc.KISSConnection, error)) error {
+	unreachable := 0
+	for _, device := range devices {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		setLogLabel(labels[device])
+		res := pingResult{Label: labels[device], Target: target(o, device)}
+		conn, err := connect(device)
+		if err != nil {
+			res.Error = err.Error()
+			unreachable++
+		} else {
+			res.Reachable = true
+			if o.pingListen > 0 {
+				frame, err := readFrameContext(ctx, conn, o.pingListen)
+				if err == nil {
+					res.Frame = ninotnc.FrameHex(frame)
+				} else if !errors.Is(err, ninotnc.ErrTimeout) && ctx.Err() == nil {
+					logger.Errorf("%s: error reading: %v", res.Target, err)
+				}
+			}
+			conn.Close()
+		}
+
+		switch {
+		case o.json:
+			json.NewEncoder(os.Stdout).Encode(res)
+		case !res.Reachable:
+			fmt.Printf("%s: unreachable: %s\n", res.Target, res.Error)
+		case res.Frame != "":
+			fmt.Printf("%s: reachable, received %s\n", res.Target, res.Frame)
+		default:
+			fmt.Printf("%s: reachable\n", res.Target)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if unreachable > 0 {
+		return withCode(exitConnect, fmt.Errorf("%d of %d devices unreachable", unreachable, len(devices)))
+	}
+	return nil
+}
+
+// readFrameContext reads one frame, closing conn to abort the read if ctx is
+// canceled first.
+func readFrameContext(ctx context.Context, conn ninotnc.KISSConnection, timeout time.Duration) ([]byte, error) {
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+	return conn.ReadFrame(timeout)
+}
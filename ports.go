@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"go.bug.st/serial/enumerator"
+)
+
+// ninoTNCUSBIDs lists the USB vendor/product IDs a NinoTNC enumerates with.
+// The board uses a Microchip MCP2221A USB-UART bridge.
+var ninoTNCUSBIDs = []struct{ vid, pid string }{
+	{"04D8", "00DD"},
+}
+
+func isNinoTNC(p *enumerator.PortDetails) bool {
+	if !p.IsUSB {
+		return false
+	}
+	for _, id := range ninoTNCUSBIDs {
+		if strings.EqualFold(p.VID, id.vid) && strings.EqualFold(p.PID, id.pid) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectSerialPort returns the one serial port that looks like a NinoTNC. If
+// several match it fails and lists them; if none match it falls back to
+// fallbackSerialPort with a warning, or fails where there is no fallback.
+func detectSerialPort() (string, error) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return "", fmt.Errorf("enumerating serial ports: %w", err)
+	}
+	var matches []string
+	for _, p := range ports {
+		if isNinoTNC(p) {
+			matches = append(matches, p.Name)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		if fallbackSerialPort == "" {
+			return "", errors.New("no NinoTNC found by USB ID; run with -list-ports and choose one with -serial-port, e.g. -serial-port COM3")
+		}
+		logger.Warnf("No NinoTNC found by USB ID, falling back to %s", fallbackSerialPort)
+		return fallbackSerialPort, nil
+	case 1:
+		logger.Infof("Detected NinoTNC on %s", matches[0])
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("several NinoTNCs found (%s); choose one with -serial-port", strings.Join(matches, ", "))
+	}
+}
+
+// waitForDevice polls every pollInterval until the serial port name, or
+// with auto a NinoTNC by USB ID, is present, giving up after timeout. A
+// NinoTNC's port disappears for a few seconds while it reboots.
+func waitForDevice(ctx context.Context, name string, timeout time.Duration) error {
+	const pollInterval = 250 * time.Millisecond
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		if devicePresent(name) {
+			return nil
+		}
+		logger.Debugf("Waiting for %s to appear (attempt %d)", name, attempt)
+		if time.Until(deadline) <= 0 {
+			return fmt.Errorf("serial port %s did not appear within %v", name, timeout)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(min(pollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+func devicePresent(name string) bool {
+	if !strings.EqualFold(name, "auto") {
+		return portExists(name)
+	}
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return false
+	}
+	for _, p := range ports {
+		if isNinoTNC(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// printPorts writes one tab-separated line per serial port: name, VID:PID,
+// serial number and product, with "-" for anything unknown.
+func printPorts(w io.Writer) error {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return fmt.Errorf("enumerating serial ports: %w", err)
+	}
+	orDash := func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	}
+	for _, p := range ports {
+		id := "-"
+		if p.IsUSB {
+			id = p.VID + ":" + p.PID
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Name, id, orDash(p.SerialNumber), orDash(p.Product))
+	}
+	return nil
+}
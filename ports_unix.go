@@ -0,0 +1,18 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// defaultSerialPort is the -serial-port default: the device node a NinoTNC's
+// MCP2221A usually gets on Linux.
+const defaultSerialPort = "/dev/ttyACM0"
+
+// fallbackSerialPort is tried when -serial-port auto finds no NinoTNC.
+const fallbackSerialPort = defaultSerialPort
+
+// portExists reports whether the serial device node name is present.
+func portExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package main
+
+import (
+	"strings"
+
+	"go.bug.st/serial"
+)
+
+// COM port numbers are assigned per machine, so there is no useful fixed
+// default: detect the NinoTNC by USB ID instead. Names such as COM3 and, for
+// ports above COM9, either COM10 or \\.\COM10 are accepted by -serial-port;
+// the serial library adds the \\.\ prefix when it is missing.
+const defaultSerialPort = "auto"
+
+// fallbackSerialPort is empty: when auto finds no NinoTNC there is nothing
+// sensible to guess, so detection fails with advice to use -list-ports.
+const fallbackSerialPort = ""
+
+// portExists reports whether the serial port name, with or without the \\.\
+// prefix, is currently enumerated. COM ports have no file to stat.
+func portExists(name string) bool {
+	ports, err := serial.GetPortsList()
+	if err != nil {
+		return false
+	}
+	name = strings.TrimPrefix(name, `\\.\`)
+	for _, p := range ports {
+		if strings.EqualFold(strings.TrimPrefix(p, `\\.\`), name) {
+			return true
+		}
+	}
+	return false
+}
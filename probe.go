@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// probeRates are the host serial rates -probe-baud tries, in order: every
+// rate -serial-baud accepts.
+var probeRates = validBaudRates
+
+// probeQuery is the frame -probe-baud sends at each rate to prompt a reply:
+// an empty data frame on KISS port 15, which a NinoTNC does not use, so it
+// is dropped without keying the radio or touching the mode.
+var probeQuery = ninotnc.BuildKISSFrameCmd(0xF0|ninotnc.KISS_CMD_DATA, nil)
+
+// probeBaud opens the serial port device at each of probeRates in turn,
+// sends probeQuery and listens for up to o.timeout for the TNC to report
+// its mode, printing each rate tried and stopping at the first that gives a
+// well-formed report. At the wrong rate the query arrives as noise and the
+// report, if any, arrives garbled.
+func probeBaud(ctx context.Context, w io.Writer, o *options, device string, connect func(*options, string) (ninotnc.KISSConnection, error)) error {
+	for _, rate := range probeRates {
+		po := *o
+		po.serialBaud = rate
+		conn, err := connect(&po, device)
+		if err != nil {
+			return withCode(exitConnect, fmt.Errorf("error opening %s at %d baud: %w", device, rate, err))
+		}
+		if _, err := conn.Write(probeQuery); err != nil {
+			conn.Close()
+			return withCode(exitWrite, fmt.Errorf("error sending the probe frame to %s at %d baud: %w", device, rate, err))
+		}
+		m, err := ninotnc.QueryMode(ctx, conn, o.timeout)
+		conn.Close()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			fmt.Fprintf(w, "%d: no mode report heard (%v)\n", rate, err)
+			continue
+		}
+		fmt.Fprintf(w, "%d: TNC reported mode %d (%s)\n", rate, m.Mode, m.Name())
+		fmt.Fprintf(w, "Found: use -serial-baud %d\n", rate)
+		return nil
+	}
+	return withCode(exitTimeout, fmt.Errorf("no mode report heard from %s at any of %d rates", device, len(probeRates)))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+	"github.com/madpsy/ninotnc-set-mode/ninotnc/kisstest"
+)
+
+// TestProbeBaudSendsQuery checks -probe-baud sends the query frame at each
+// rate and stops at the rate where the TNC answers it with a mode report.
+func TestProbeBaudSendsQuery(t *testing.T) {
+	report := []byte{ninotnc.KISS_FLAG, ninotnc.KISS_CMD_SETHW, 0x13, ninotnc.KISS_FLAG}
+	var conns []*kisstest.Conn
+	var rates []int
+	connect := func(o *options, device string) (ninotnc.KISSConnection, error) {
+		c := kisstest.New()
+		if o.serialBaud == 9600 {
+			c.Respond = func(frame []byte) []byte {
+				if bytes.Equal(frame, probeQuery) {
+					return report
+				}
+				return nil
+			}
+		}
+		conns = append(conns, c)
+		rates = append(rates, o.serialBaud)
+		return c, nil
+	}
+
+	var out bytes.Buffer
+	if err := probeBaud(context.Background(), &out, &options{timeout: 50 * time.Millisecond}, "/dev/ttyACM0", connect); err != nil {
+		t.Fatalf("probeBaud: %v", err)
+	}
+	if got := rates[len(rates)-1]; got != 9600 {
+		t.Errorf("stopped at %d baud, want 9600 (tried %v)", got, rates)
+	}
+	for i, c := range conns {
+		frames := c.Frames()
+		if len(frames) != 1 || !bytes.Equal(frames[0], probeQuery) {
+			t.Errorf("at %d baud sent % X, want just the query % X", rates[i], frames, probeQuery)
+		}
+		if !c.Closed() {
+			t.Errorf("connection at %d baud left open", rates[i])
+		}
+	}
+	if want := "Found: use -serial-baud 9600"; !strings.Contains(out.String(), want) {
+		t.Errorf("output %q does not contain %q", out.String(), want)
+	}
+}
+
+// TestProbeQueryHarmless checks the query cannot change the mode: it is a
+// data frame, not a set-mode command, addressed to the unused port 15, and
+// carries nothing to transmit.
+func TestProbeQueryHarmless(t *testing.T) {
+	frames := ninotnc.DecodeFrames(probeQuery)
+	if len(frames) != 1 || frames[0].Err != nil || len(frames[0].Payload) != 0 {
+		t.Fatalf("probeQuery % X, want one frame holding only a command byte", probeQuery)
+	}
+	if cmd := frames[0].Cmd; cmd&0x0F != ninotnc.KISS_CMD_DATA || cmd>>4 != 15 {
+		t.Errorf("probeQuery command byte %02X, want a data frame on KISS port 15", cmd)
+	}
+}
+
+func TestProbeBaudNoReport(t *testing.T) {
+	connect := func(*options, string) (ninotnc.KISSConnection, error) {
+		return kisstest.New(), nil
+	}
+	var out bytes.Buffer
+	err := probeBaud(context.Background(), &out, &options{timeout: 50 * time.Millisecond}, "/dev/ttyACM0", connect)
+	if exitCode(err) != exitTimeout {
+		t.Errorf("probeBaud with a silent TNC = %v, exit code %d, want %d", err, exitCode(err), exitTimeout)
+	}
+	if n := strings.Count(out.String(), "no mode report heard"); n != len(probeRates) {
+		t.Errorf("reported %d silent rates, want %d:\n%s", n, len(probeRates), out.String())
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// parseHexBytes decodes a hex string such as "0102", "01 02", "01:02" or
+// "0x0102".
+func parseHexBytes(s string) ([]byte, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "0x"), "0X")
+	s = strings.NewReplacer(" ", "", ":", "", "-", "").Replace(s)
+	return hex.DecodeString(s)
+}
+
+// parseHexByte decodes the value of the named flag, a single hex byte with
+// an optional 0x prefix.
+func parseHexByte(name, s string) (byte, error) {
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "0x"), "0X"), 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid -%s %q: must be a single hex byte, e.g. 06", name, s)
+	}
+	return byte(v), nil
+}
+
+// parseCommands parses -commands, comma-separated cmd:payload pairs in hex
+// such as 06:03,0A:01; the payload may be left out.
+func parseCommands(s string) ([]ninotnc.Command, error) {
+	var cmds []ninotnc.Command
+	for _, item := range splitList(s) {
+		cmdStr, payloadStr, _ := strings.Cut(item, ":")
+		cmd, err := parseHexByte("commands", cmdStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -commands entry %q: command must be a single hex byte, e.g. 06", item)
+		}
+		payload, err := parseHexBytes(payloadStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -commands entry %q: %v", item, err)
+		}
+		cmds = append(cmds, ninotnc.Command{Cmd: cmd, Payload: payload})
+	}
+	if len(cmds) == 0 {
+		return nil, fmt.Errorf("-commands has no entries")
+	}
+	return cmds, nil
+}
+
+// parseNumber parses s as a decimal integer, or as hex, octal or binary
+// when it has an explicit 0x, 0o or 0b prefix. Unlike base 0 in strconv, a
+// plain leading zero does not mean octal, so 010 is ten and 0011, typed the
+// way a DIP pattern looks, is eleven.
+func parseNumber(s string, bitSize int) (int64, error) {
+	s = strings.TrimSpace(s)
+	digits := strings.TrimLeft(s, "+-")
+	if len(digits) > 2 && digits[0] == '0' && strings.ContainsRune("xXoObB", rune(digits[1])) {
+		return strconv.ParseInt(s, 0, bitSize)
+	}
+	return strconv.ParseInt(s, 10, bitSize)
+}
+
+// modeNumber is the -mode flag value, parsed with parseNumber.
+type modeNumber int
+
+func (m *modeNumber) String() string { return strconv.Itoa(int(*m)) }
+func (m *modeNumber) Get() any       { return int(*m) }
+
+func (m *modeNumber) Set(s string) error {
+	v, err := parseNumber(s, strconv.IntSize)
+	if err != nil {
+		return errors.New("must be a decimal number, or hex, octal or binary with a 0x, 0o or 0b prefix")
+	}
+	*m = modeNumber(v)
+	return nil
+}
+
+// parseModeRaw decodes -mode-raw, a set-mode byte in decimal or with a 0x,
+// 0o or 0b prefix. Only bytes that select a mode, with or without the +16
+// offset, are accepted; anything else can be sent with -raw-cmd.
+func parseModeRaw(s string) (byte, error) {
+	v, err := parseNumber(s, 16)
+	if err != nil || v < 0 || v > 0xFF {
+		return 0, fmt.Errorf("invalid -mode-raw %q: must be a byte, e.g. 0x13 or 19", s)
+	}
+	if err := ninotnc.ValidateMode(int(v & 0x0F)); err != nil || v >= 32 {
+		return 0, fmt.Errorf("invalid -mode-raw %q: %02X does not select a mode; use -raw-cmd 06 -raw-payload %02X to send it anyway", s, v, v)
+	}
+	return byte(v), nil
+}
+
+// sendRaw writes frame over conn and prints the first frame received within
+// cfg.timeout as hex. Only cfg.timeout and cfg.requireAck are used.
+func sendRaw(ctx context.Context, conn ninotnc.KISSConnection, frame []byte, cfg sendConfig) error {
+	// Closing conn unblocks a pending write or read when ctx is canceled.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	n, err := conn.Write(frame)
+	if err == nil && n < len(frame) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return withCode(exitWrite, fmt.Errorf("error sending raw frame: %w", explainWrite(err)))
+	}
+	logger.Infof("Sent raw KISS frame: % X", frame)
+
+	response, err := conn.ReadFrame(cfg.timeout)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		if errors.Is(err, ninotnc.ErrTimeout) && !cfg.requireAck {
+			logger.Warnf("No response from TNC: %v", err)
+			return nil
+		}
+		return withCode(exitTimeout, fmt.Errorf("no response from TNC: %w", err))
+	}
+	fmt.Println(ninotnc.FrameHex(response))
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"testing"
+)
+
+// TestModeFlagDecimal checks -mode reads a leading zero as decimal, not
+// octal, and only switches base for an explicit prefix.
+func TestModeFlagDecimal(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want int
+	}{
+		{"3", 3},
+		{"010", 10},
+		{"0011", 11},
+		{"09", 9},
+		{"0", 0},
+		{"0x13", 19},
+		{"0X0a", 10},
+		{"0o17", 15},
+		{"0b11", 3},
+	}
+	for _, tt := range tests {
+		o, err := parseLayers(t, []string{"-mode", tt.arg}, nil, "")
+		if err != nil {
+			t.Fatalf("-mode %s: %v", tt.arg, err)
+		}
+		if o.mode != tt.want {
+			t.Errorf("-mode %s set mode %d, want %d", tt.arg, o.mode, tt.want)
+		}
+	}
+	for _, arg := range []string{"", "abc", "0x", "3.0", "0b12"} {
+		var o options
+		fs := flag.NewFlagSet("setmode", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		o.register(fs)
+		if err := fs.Parse([]string{"-mode", arg}); err == nil {
+			t.Errorf("-mode %q was accepted as %d", arg, o.mode)
+		}
+	}
+}
+
+func TestParseModeRaw(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want byte
+		ok   bool
+	}{
+		{"0x13", 0x13, true},
+		{"19", 0x13, true},
+		{"019", 0x13, true},
+		{"03", 0x03, true},
+		{"0b10011", 0x13, true},
+		{"0x0F", 0, false},
+		{"0x20", 0, false},
+		{"256", 0, false},
+		{"-1", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseModeRaw(tt.arg)
+		if tt.ok && (err != nil || got != tt.want) {
+			t.Errorf("parseModeRaw(%q) = %02X, %v, want %02X", tt.arg, got, err, tt.want)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("parseModeRaw(%q) = %02X, want an error", tt.arg, got)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// scheduleEntry is one step of -schedule: a mode and how long to stay in it.
+type scheduleEntry struct {
+	mode int
+	dur  time.Duration
+}
+
+// parseSchedule parses -schedule, comma-separated mode:duration entries such
+// as 3:60s,10:60s. Every entry is checked: the valid ones are returned along
+// with one error per invalid entry.
+func parseSchedule(s string, allowed modeSet) ([]scheduleEntry, []error) {
+	var entries []scheduleEntry
+	var problems []error
+	for _, item := range splitList(s) {
+		e, err := parseScheduleEntry(item, allowed)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid -schedule entry %q: %w", item, err))
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 && len(problems) == 0 {
+		problems = append(problems, fmt.Errorf("-schedule has no entries"))
+	}
+	return entries, problems
+}
+
+func parseScheduleEntry(item string, allowed modeSet) (scheduleEntry, error) {
+	modeStr, durStr, ok := strings.Cut(item, ":")
+	if !ok {
+		return scheduleEntry{}, fmt.Errorf("want mode:duration, e.g. 3:60s")
+	}
+	mode, err := strconv.Atoi(strings.TrimSpace(modeStr))
+	if err != nil {
+		return scheduleEntry{}, fmt.Errorf("mode must be a number")
+	}
+	if err := ninotnc.ValidateMode(mode); err != nil {
+		return scheduleEntry{}, err
+	}
+	if err := allowed.check(mode); err != nil {
+		return scheduleEntry{}, err
+	}
+	dur, err := time.ParseDuration(strings.TrimSpace(durStr))
+	if err != nil || dur <= 0 {
+		return scheduleEntry{}, fmt.Errorf("duration must be positive, e.g. 60s")
+	}
+	return scheduleEntry{mode, dur}, nil
+}
+
+// runSchedule applies each entry's mode over conn and holds it for the
+// entry's duration, looping through the entries until ctx is canceled. The
+// TNC is left in whatever mode was current when it stops. A failed change is
+// logged and the schedule carries on.
+func runSchedule(ctx context.Context, conn ninotnc.KISSConnection, entries []scheduleEntry, cfg sendConfig) error {
+	current := -1
+	for cycle := 1; ; cycle++ {
+		for i, e := range entries {
+			m, _ := ninotnc.LookupMode(e.mode)
+			until := time.Now().Add(e.dur)
+			logger.Infof("Cycle %d step %d of %d: mode %d (%s) until %s", cycle, i+1, len(entries), e.mode, m.Name(), until.Format(time.TimeOnly))
+			if _, err := sendMode(ctx, conn, e.mode, cfg); ctx.Err() != nil {
+				break
+			} else if err != nil {
+				logger.Errorf("Mode %d: %v", e.mode, err)
+			} else {
+				current = e.mode
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Until(until)):
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			if current >= 0 {
+				logger.Infof("Schedule stopped; TNC left in mode %d", current)
+			}
+			return ctx.Err()
+		}
+	}
+}
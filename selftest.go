@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// selfTestCase is a frame looped back by -selftest and the command byte and
+// payload it must decode to. For set-mode frames, wire is the exact bytes
+// the frame must consist of, written out by hand, so any change to the wire
+// format fails the test rather than round-tripping unnoticed.
+type selfTestCase struct {
+	name  string
+	frame []byte
+	want  []byte
+	wire  []byte
+}
+
+func selfTestCases() ([]selfTestCase, error) {
+	var cases []selfTestCase
+	// Bytes that must be escaped, and the bytes that follow an escape, in
+	// both the payload and the command byte.
+	delim := ninotnc.FrameDelimiter()
+	tricky := []byte{delim, ninotnc.KISS_FESC, ninotnc.KISS_TFEND, ninotnc.KISS_TFESC, 0x13}
+	// Every byte value, so an escape the decoder does not undo, or undoes
+	// differently, shows up whichever byte it affects.
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+	cases = append(cases,
+		selfTestCase{"every byte value", ninotnc.BuildKISSFrameCmd(ninotnc.KISS_CMD_DATA, all), append([]byte{ninotnc.KISS_CMD_DATA}, all...), nil},
+		selfTestCase{"escaped payload", ninotnc.BuildKISSFrameCmd(ninotnc.KISS_CMD_SETHW, tricky), append([]byte{ninotnc.KISS_CMD_SETHW}, tricky...), nil},
+		selfTestCase{"escaped command byte", ninotnc.BuildKISSFrameCmd(ninotnc.KISS_FESC, []byte{delim}), []byte{ninotnc.KISS_FESC, delim}, nil},
+	)
+	for _, m := range ninotnc.Modes() {
+		for _, write := range []bool{false, true} {
+			frame, err := ninotnc.SetModeFrame(m.Mode, write, ninotnc.SetModeOptions{})
+			if err != nil {
+				return nil, err
+			}
+			b := byte(m.Mode)
+			if !write {
+				b += 16
+			}
+			// No mode byte, offset or not, reaches 0xC0 or 0xDB, so none is
+			// escaped.
+			wire := []byte{delim, 0x06, b, delim}
+			cases = append(cases, selfTestCase{fmt.Sprintf("mode %d write=%v", m.Mode, write), frame, []byte{ninotnc.KISS_CMD_SETHW, b}, wire})
+		}
+	}
+	return cases, nil
+}
+
+// runSelfTest writes each selfTestCases frame into one end of a new PTY
+// pair, reads it back from the other through the frame decoder, and prints
+// PASS or FAIL for each. It checks escaping and framing end to end without a
+// TNC.
+func runSelfTest(ctx context.Context, w io.Writer, timeout time.Duration) error {
+	master, err := ninotnc.NewPTYKISSConnection("")
+	if err != nil {
+		return withCode(exitConnect, fmt.Errorf("error creating PTY: %w", err))
+	}
+	defer master.Close()
+	peer, err := ninotnc.NewPTYKISSConnection(master.Path())
+	if err != nil {
+		return withCode(exitConnect, fmt.Errorf("error opening PTY: %w", err))
+	}
+	defer peer.Close()
+
+	delim := ninotnc.FrameDelimiter()
+	cases, err := selfTestCases()
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, c := range cases {
+		if bytes.IndexByte(c.frame[1:len(c.frame)-1], delim) >= 0 {
+			fmt.Fprintf(w, "FAIL %s: built %s, which has an unescaped delimiter inside the frame\n", c.name, ninotnc.FrameHex(c.frame))
+			failed++
+			continue
+		}
+		if c.wire != nil && !bytes.Equal(c.frame, c.wire) {
+			fmt.Fprintf(w, "FAIL %s: built %s, want %s\n", c.name, ninotnc.FrameHex(c.frame), ninotnc.FrameHex(c.wire))
+			failed++
+			continue
+		}
+		if _, err := master.Write(c.frame); err != nil {
+			return withCode(exitWrite, fmt.Errorf("error writing to PTY: %w", err))
+		}
+		got, err := readFrameContext(ctx, peer, timeout)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		switch {
+		case err != nil:
+			fmt.Fprintf(w, "FAIL %s: %v\n", c.name, err)
+			failed++
+		case !bytes.Equal(got, c.want):
+			fmt.Fprintf(w, "FAIL %s: sent %s, decoded %s, want %s\n", c.name, ninotnc.FrameHex(c.frame), ninotnc.FrameHex(got), ninotnc.FrameHex(c.want))
+			failed++
+		default:
+			fmt.Fprintf(w, "PASS %s\n", c.name)
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(w, "FAIL: %d of %d frames did not round-trip\n", failed, len(cases))
+		return fmt.Errorf("self-test failed")
+	}
+	fmt.Fprintf(w, "PASS: %d frames round-tripped\n", len(cases))
+	return nil
+}
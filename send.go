@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// sendConfig carries the settings shared by every set-mode command in a run.
+type sendConfig struct {
+	write   bool
+	opts    ninotnc.SetModeOptions
+	timeout time.Duration
+	// settle is how long to keep the connection open after the last command
+	// before closing it.
+	settle time.Duration
+	// requireAck turns a missing acknowledgement into an error.
+	requireAck bool
+	// force downgrades an acknowledgement reporting a different mode, which
+	// usually means the DIP switches are not all ON, to a warning.
+	force bool
+	// repeat is how many times to send the command when no acknowledgement
+	// arrives, waiting repeatGap for one between sends.
+	repeat    int
+	repeatGap time.Duration
+	// hold keeps the connection open, reading frames, before settling.
+	hold time.Duration
+	// verify reconnects after a successful write to check the TNC reports
+	// the stored mode.
+	verify bool
+	// allowed, when set, is the only modes that may be sent.
+	allowed modeSet
+	// diff listens for the TNC to report its mode first, and sends nothing
+	// if it is already in the requested one.
+	diff bool
+	// link, when set, checks the link works at the new mode by hearing a
+	// test frame back once the mode is set.
+	link *linkCheck
+}
+
+// applyMode connects, sends the set-mode command and waits for the TNC to
+// acknowledge it.
+func applyMode(ctx context.Context, connect func() (ninotnc.KISSConnection, error), mode int, cfg sendConfig) (ninotnc.SetModeResult, error) {
+	conn, err := connect()
+	if err != nil {
+		return ninotnc.SetModeResult{}, withCode(exitConnect, fmt.Errorf("error establishing connection: %w", err))
+	}
+	if cfg.diff {
+		same, err := alreadyInMode(ctx, conn, mode, cfg)
+		if err != nil || same {
+			conn.Close()
+			return ninotnc.SetModeResult{RequestedMode: mode, EffectiveMode: mode}, err
+		}
+	}
+	res, err := sendMode(ctx, conn, mode, cfg)
+	settle(ctx, conn, cfg)
+	if res.BytesSent > 0 && ctx.Err() == nil {
+		logger.Infof("%v", describeTiming(res))
+	}
+	if err == nil && cfg.link != nil {
+		err = verifyLink(ctx, conn, *cfg.link, cfg.opts.KISSPort)
+	}
+	conn.Close()
+	if err == nil && cfg.verify {
+		err = verifyStored(ctx, connect, res, cfg.timeout)
+	}
+	return res, err
+}
+
+// alreadyInMode listens up to cfg.timeout for the TNC to report its mode and
+// reports whether it is mode. No report is not an error: the command is then
+// sent as usual. The report shows the running mode, so with cfg.write a
+// match is taken to mean the mode is already stored; a mode set only until
+// power off would be missed.
+func alreadyInMode(ctx context.Context, conn ninotnc.KISSConnection, mode int, cfg sendConfig) (bool, error) {
+	current, err := ninotnc.QueryMode(ctx, conn, cfg.timeout)
+	switch {
+	case ctx.Err() != nil:
+		return false, ctx.Err()
+	case err != nil:
+		logger.Warnf("Could not read the current mode (%v); sending anyway", err)
+		return false, nil
+	case current.Mode != mode:
+		logger.Infof("TNC is in mode %d (%s); changing to %d", current.Mode, current.Name(), mode)
+		return false, nil
+	}
+	if cfg.write {
+		logger.Infof("Already in mode %d (%s), no change needed; not writing to TNC memory", mode, current.Name())
+	} else {
+		logger.Infof("Already in mode %d (%s), no change needed", mode, current.Name())
+	}
+	return true, nil
+}
+
+// describeTiming summarises how much was sent and how long the TNC took:
+// the acknowledgement round trip, or without one the time until the
+// connection was closed after settling.
+func describeTiming(res ninotnc.SetModeResult) string {
+	if res.Acknowledged() {
+		return fmt.Sprintf("Sent %d bytes, ack in %.1fms", res.BytesSent, millis(res.RoundTrip))
+	}
+	return fmt.Sprintf("Sent %d bytes, no ack, done in %.1fms", res.BytesSent, millis(time.Since(res.SentAt)))
+}
+
+// millis converts d to fractional milliseconds.
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// settleAndClose settles conn, then closes it.
+func settleAndClose(ctx context.Context, conn ninotnc.KISSConnection, cfg sendConfig) {
+	settle(ctx, conn, cfg)
+	conn.Close()
+}
+
+// settle drains any buffered serial output, holds the connection open
+// reading frames for cfg.hold and waits cfg.settle so the TNC can act on the
+// command.
+func settle(ctx context.Context, conn ninotnc.KISSConnection, cfg sendConfig) {
+	if d, ok := conn.(interface{ Drain() error }); ok {
+		if err := d.Drain(); err != nil {
+			logger.Warnf("Error draining output: %v", err)
+		}
+	}
+	if cfg.hold > 0 {
+		hold(ctx, conn, cfg.hold)
+	}
+	if cfg.settle > 0 {
+		select {
+		case <-ctx.Done():
+		case <-time.After(cfg.settle):
+		}
+	}
+}
+
+// hold reads and logs frames from conn until d has passed. Unlike the
+// settle delay, which only sleeps, this keeps taking whatever the TNC sends,
+// for boards that revert a change if the host stops reading too soon.
+func hold(ctx context.Context, conn ninotnc.KISSConnection, d time.Duration) {
+	logger.Infof("Holding connection open for %v", d)
+	deadline := time.Now().Add(d)
+	for {
+		remaining := time.Until(deadline)
+		if remaining <= 0 || ctx.Err() != nil {
+			return
+		}
+		frame, err := readFrameContext(ctx, conn, remaining)
+		if errors.Is(err, ninotnc.ErrTimeout) || ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logger.Warnf("Error reading while holding connection: %v", err)
+			return
+		}
+		logger.Infof("Received while holding: % X", frame)
+	}
+}
+
+// sendMode sends the set-mode command over an open connection and waits for
+// the acknowledgement. Unless cfg.requireAck is set, a missing
+// acknowledgement is logged but is not an error.
+func sendMode(ctx context.Context, conn ninotnc.KISSConnection, mode int, cfg sendConfig) (ninotnc.SetModeResult, error) {
+	if err := cfg.allowed.check(mode); err != nil {
+		return ninotnc.SetModeResult{}, withCode(exitUsage, err)
+	}
+	// Setting the same mode again is harmless, so on a noisy link the
+	// command is repeated until acknowledged. Only the last send waits the
+	// full timeout.
+	var res ninotnc.SetModeResult
+	repeat := max(cfg.repeat, 1)
+	bytesSent := 0
+	var firstSent time.Time
+	for i := 1; i <= repeat; i++ {
+		opts := cfg.opts
+		opts.AckTimeout = cfg.timeout
+		if i < repeat {
+			opts.AckTimeout = cfg.repeatGap
+		}
+		if repeat > 1 {
+			logger.Infof("Send %d of %d", i, repeat)
+		}
+		var err error
+		res, err = ninotnc.SetModeWithOptions(ctx, conn, mode, cfg.write, opts)
+		bytesSent += res.BytesSent
+		if i == 1 {
+			firstSent = res.SentAt
+		}
+		if errors.Is(err, context.Canceled) {
+			return res, err
+		} else if errors.Is(err, ninotnc.ErrInvalidMode) || errors.Is(err, ninotnc.ErrInvalidOptions) {
+			// Nothing was sent: the frame could not be built.
+			return res, withCode(exitUsage, fmt.Errorf("error setting mode: %w", err))
+		} else if err != nil {
+			return res, withCode(exitWrite, fmt.Errorf("error setting mode: %w", explainWrite(err)))
+		}
+		if res.Acknowledged() {
+			break
+		}
+	}
+	res.BytesSent = bytesSent
+	res.SentAt = firstSent
+
+	if !res.Acknowledged() {
+		if cfg.requireAck {
+			return res, withCode(exitTimeout, fmt.Errorf("no acknowledgement from TNC: %w", res.AckErr))
+		}
+		logger.Warnf("No acknowledgement from TNC: %v", res.AckErr)
+		return res, nil
+	}
+	logger.Infof("Received acknowledgement: % X", res.Response)
+	if err := checkDIP(res, cfg.force); err != nil {
+		return res, err
+	}
+	logger.Infof("%v", describeResult(res))
+	return res, nil
+}
+
+// describeResult summarises an acknowledged set-mode command for the log.
+func describeResult(res ninotnc.SetModeResult) string {
+	m, _ := ninotnc.LookupMode(res.EffectiveMode)
+	stored := "until power off"
+	if res.Persisted {
+		stored = "stored in TNC memory"
+	}
+	return fmt.Sprintf("TNC now in mode %d (%s), %s", m.Mode, m.Name(), stored)
+}
+
+// checkDIP compares the mode the TNC acknowledged with the one requested.
+// The firmware only obeys set-mode commands with the DIP switches at 1111 and
+// has no frame reporting the switches themselves, so an acknowledgement for
+// another mode is the best available sign that they select it instead.
+func checkDIP(res ninotnc.SetModeResult, force bool) error {
+	if res.EffectiveMode == res.RequestedMode {
+		return nil
+	}
+	reported, _ := ninotnc.LookupMode(res.EffectiveMode)
+	err := fmt.Errorf("TNC reports mode %d (DIP %s) instead of %d; check the DIP switches are all ON (1111)", reported.Mode, reported.DIP, res.RequestedMode)
+	if force {
+		logger.Warnf("%v", err)
+		return nil
+	}
+	return fmt.Errorf("%w, or pass -force to ignore", err)
+}
+
+// runQuery listens for the TNC to report its mode and prints it. The firmware
+// has no documented query command, so nothing is sent.
+func runQuery(ctx context.Context, conn ninotnc.KISSConnection, timeout time.Duration) error {
+	mode, err := ninotnc.QueryMode(ctx, conn, timeout)
+	if errors.Is(err, ninotnc.ErrTimeout) {
+		return withCode(exitTimeout, fmt.Errorf("error querying mode: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("error querying mode: %w", err)
+	}
+	fmt.Println(describeMode(mode))
+	return nil
+}
+
+// jsonResult is the object printed to stdout for each device with -json.
+type jsonResult struct {
+	Label      string `json:"label,omitempty"`
+	Connection string `json:"connection"`
+	Target     string `json:"target"`
+	Mode       int    `json:"mode"`
+	Write      bool   `json:"write"`
+	Frame      string `json:"frame"`
+	// EffectiveMode is the mode the TNC acknowledged, absent without an
+	// acknowledgement.
+	EffectiveMode *int   `json:"effective_mode,omitempty"`
+	Response      string `json:"response,omitempty"`
+	BytesSent     int    `json:"bytes_sent"`
+	// AckMillis is the acknowledgement round trip in milliseconds.
+	AckMillis *float64 `json:"ack_ms,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+	"github.com/madpsy/ninotnc-set-mode/ninotnc/kisstest"
+)
+
+// blockingConn is a KISSConnection whose writes block until it is closed,
+// like a serial port stuck mid-write, and which records the Close.
+type blockingConn struct {
+	writing   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newBlockingConn() *blockingConn {
+	return &blockingConn{writing: make(chan struct{}, 1), closed: make(chan struct{})}
+}
+
+func (c *blockingConn) Write(b []byte) (int, error) {
+	select {
+	case c.writing <- struct{}{}:
+	default:
+	}
+	<-c.closed
+	return 0, net.ErrClosed
+}
+
+func (c *blockingConn) Read(b []byte) (int, error) {
+	<-c.closed
+	return 0, net.ErrClosed
+}
+
+func (c *blockingConn) ReadFrame(timeout time.Duration) ([]byte, error) {
+	select {
+	case <-c.closed:
+		return nil, net.ErrClosed
+	case <-time.After(timeout):
+		return nil, ninotnc.ErrTimeout
+	}
+}
+
+func (c *blockingConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *blockingConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// TestApplyModeClosesOnCancel cancels the context, as Ctrl-C does, while a
+// write is blocked, and checks the connection is closed to release it and
+// the run ends with the interrupted exit code.
+func TestApplyModeClosesOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn := newBlockingConn()
+	done := make(chan error, 1)
+	go func() {
+		_, err := applyMode(ctx, func() (ninotnc.KISSConnection, error) { return conn, nil }, 3, sendConfig{timeout: time.Second, repeat: 1})
+		done <- err
+	}()
+
+	select {
+	case <-conn.writing:
+	case <-time.After(time.Second):
+		t.Fatal("applyMode never wrote to the connection")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("applyMode returned %v, want context.Canceled", err)
+		}
+		if code := exitCode(err); code != exitInterrupted {
+			t.Errorf("exitCode = %d, want %d", code, exitInterrupted)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("applyMode did not return after the context was canceled")
+	}
+	if !conn.isClosed() {
+		t.Error("connection was not closed")
+	}
+}
+
+// runArgs runs the tool with args as the command line, without applying the
+// environment or a config file, and returns run's error.
+func runArgs(t *testing.T, args ...string) error {
+	t.Helper()
+	saved := flag.CommandLine
+	t.Cleanup(func() { flag.CommandLine = saved })
+	flag.CommandLine = flag.NewFlagSet("setmode", flag.ContinueOnError)
+	flag.CommandLine.SetOutput(io.Discard)
+	var o options
+	o.register(flag.CommandLine)
+	if err := flag.CommandLine.Parse(args); err != nil {
+		t.Fatalf("Parse(%q): %v", args, err)
+	}
+	return run(context.Background(), &o)
+}
+
+func TestModeRawOutOfRangeExitCode(t *testing.T) {
+	for _, raw := range []string{"0x1F", "0x20", "0xFF", "256"} {
+		err := runArgs(t, "-connection", "tcp", "-mode-raw", raw, "-dry-run")
+		if code := exitCode(err); code != exitUsage {
+			t.Errorf("-mode-raw %s: exit code %d (%v), want %d", raw, code, err, exitUsage)
+		}
+	}
+}
+
+// TestSendModeExitCodes checks a frame that cannot be built is a usage
+// error, not a write error, and that a real write failure still is one.
+func TestSendModeExitCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		mode int
+		opts ninotnc.SetModeOptions
+		conn func() ninotnc.KISSConnection
+		want int
+	}{
+		{"mode outside the table", 15, ninotnc.SetModeOptions{}, nil, exitUsage},
+		{"KISS port out of range", 3, ninotnc.SetModeOptions{KISSPort: 16}, nil, exitUsage},
+		{"opcode too wide for the port", 3, ninotnc.SetModeOptions{KISSPort: 1, Command: 0x10}, nil, exitUsage},
+		{"old firmware", 3, ninotnc.SetModeOptions{Firmware: 1}, nil, exitUsage},
+		{"closed connection", 3, ninotnc.SetModeOptions{}, func() ninotnc.KISSConnection {
+			c := kisstest.New()
+			c.Close()
+			return c
+		}, exitWrite},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var conn ninotnc.KISSConnection = kisstest.New()
+			if tt.conn != nil {
+				conn = tt.conn()
+			}
+			_, err := sendMode(context.Background(), conn, tt.mode, sendConfig{opts: tt.opts, timeout: time.Millisecond, repeat: 1})
+			if code := exitCode(err); code != tt.want {
+				t.Errorf("exit code %d (%v), want %d", code, err, tt.want)
+			}
+		})
+	}
+}
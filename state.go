@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// stateEntry is what -state-file records for one TNC: the mode last set on
+// it and the boot it was set during.
+type stateEntry struct {
+	Mode    int       `json:"mode"`
+	Write   bool      `json:"write"`
+	BootID  string    `json:"boot_id"`
+	Applied time.Time `json:"applied"`
+}
+
+// stateFile is the -state-file contents, keyed by connection type and
+// target such as "tcp 192.168.1.50:8001", so one file can cover several
+// TNCs.
+type stateFile struct {
+	path    string
+	bootID  string
+	entries map[string]stateEntry
+}
+
+// loadState reads the -state-file at path, treating a missing file as
+// empty. bootID identifies the current boot; entries recorded during another
+// are out of date.
+func loadState(path, bootID string) (*stateFile, error) {
+	s := &stateFile{path: path, bootID: bootID, entries: map[string]stateEntry{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading -state-file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.entries); err != nil {
+		return nil, fmt.Errorf("invalid -state-file %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// applied reports whether mode, stored or not as write says, was already
+// set on the TNC key names during the current boot.
+func (s *stateFile) applied(key string, mode int, write bool) bool {
+	e, ok := s.entries[key]
+	return ok && e.BootID == s.bootID && e.Mode == mode && e.Write == write
+}
+
+// record notes that mode was set on the TNC key names and saves the file. It
+// is written to a temporary file first and renamed into place, so a run
+// that is interrupted never leaves it half written.
+func (s *stateFile) record(key string, mode int, write bool) error {
+	s.entries[key] = stateEntry{Mode: mode, Write: write, BootID: s.bootID, Applied: time.Now().UTC().Truncate(time.Second)}
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// bootID returns the -boot-id flag if set, otherwise the host's boot ID,
+// which changes each time the host starts. The firmware reports nothing that
+// changes when it restarts, so the host's boot stands in for a TNC powered
+// from its USB port; a TNC with its own supply needs -boot-id.
+func bootID(o *options) (string, error) {
+	if o.bootID != "" {
+		return o.bootID, nil
+	}
+	data, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return "", errors.New("the host's boot ID is not available here; give the -state-file flag a -boot-id")
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// openState checks -state-file applies and loads it, returning nil without
+// it. It guards a single mode change, so it is refused with the batch,
+// interactive and raw command modes.
+func openState(o *options) (*stateFile, error) {
+	if o.stateFile == "" {
+		if o.bootID != "" {
+			return nil, errors.New("the -boot-id flag requires -state-file")
+		}
+		return nil, nil
+	}
+	if o.stdin || o.interactive || o.controlFIFO != "" || o.schedule != "" || o.rawCmd != "" || o.commands != "" || o.ax25Dest != "" {
+		return nil, errors.New("the -state-file flag only applies when setting a mode with -mode or another mode selection")
+	}
+	id, err := bootID(o)
+	if err != nil {
+		return nil, err
+	}
+	return loadState(o.stateFile, id)
+}
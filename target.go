@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// applyTarget fills in the connection flags from -target, a URL in the
+// -fallback form such as tcp://host:5001 or serial:///dev/ttyACM0?baud=57600.
+// A comma-separated list names several devices, which must share the
+// transport, port and baud rate as devices given with -host or -serial-port
+// do. Flags set explicitly, including from the environment or a config file,
+// override the URL.
+func applyTarget(o *options) error {
+	if o.target == "" {
+		return nil
+	}
+	var first transport
+	var devices []string
+	for i, s := range splitList(o.target) {
+		t, err := parseTransport(o, s)
+		if err != nil {
+			return fmt.Errorf("invalid -target %q: %w", s, err)
+		}
+		if i == 0 {
+			first = t
+		} else if t.o.connectionType != first.o.connectionType || t.o.port != first.o.port || t.o.serialBaud != first.o.serialBaud {
+			return fmt.Errorf("invalid -target %q: every entry must use the same transport, port and baud rate as the first", s)
+		}
+		devices = append(devices, t.device)
+	}
+	if len(devices) == 0 {
+		return errors.New("-target has no entries")
+	}
+	if !flagGiven("connection") {
+		o.connectionType = first.o.connectionType
+	}
+	if !flagGiven("port") {
+		o.port = first.o.port
+	}
+	if !flagGiven("serial-baud") {
+		o.serialBaud = first.o.serialBaud
+	}
+	list := strings.Join(devices, ",")
+	switch {
+	case first.o.connectionType == "serial" && !flagGiven("serial-port"):
+		o.serialPort = list
+	case first.o.connectionType != "serial" && !flagGiven("host"):
+		o.host = list
+	}
+	return nil
+}
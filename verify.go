@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// verifyStored checks that a -write took, in two steps. The acknowledgement
+// must echo the mode byte without the non-persistent offset, showing the TNC
+// took the command as a write rather than a temporary change. Then, on a fresh connection, the TNC
+// must report the requested mode. The firmware has no command to read its
+// stored setting back, so the second step relies on the status frame the TNC
+// sends on its own when a connection opens, and cannot tell the stored mode
+// from the running one; only a power cycle proves that.
+func verifyStored(ctx context.Context, connect func() (ninotnc.KISSConnection, error), res ninotnc.SetModeResult, timeout time.Duration) error {
+	if !res.Acknowledged() {
+		return withCode(exitVerify, fmt.Errorf("cannot verify the write: no acknowledgement from TNC: %w", res.AckErr))
+	}
+	if len(res.Response) < 2 || res.Response[1] >= 16 {
+		return withCode(exitVerify, fmt.Errorf("TNC acknowledged % X, which does not confirm the mode was stored", res.Response))
+	}
+	conn, err := connect()
+	if err != nil {
+		return withCode(exitConnect, fmt.Errorf("error reconnecting to verify: %w", err))
+	}
+	defer conn.Close()
+	logger.Infof("Reconnected, waiting up to %v for the TNC to report its mode", timeout)
+	reported, err := ninotnc.QueryMode(ctx, conn, timeout)
+	if errors.Is(err, context.Canceled) {
+		return err
+	} else if errors.Is(err, ninotnc.ErrTimeout) {
+		return withCode(exitVerify, errors.New("cannot verify the write: the TNC did not report its mode after reconnecting"))
+	} else if err != nil {
+		return withCode(exitVerify, fmt.Errorf("error verifying the write: %w", err))
+	}
+	if reported.Mode != res.RequestedMode {
+		return withCode(exitVerify, fmt.Errorf("verification failed: TNC reports mode %d after writing %d", reported.Mode, res.RequestedMode))
+	}
+	logger.Infof("Verified: TNC reports mode %d (%s) after reconnecting", reported.Mode, reported.Name())
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/madpsy/ninotnc-set-mode/ninotnc"
+)
+
+// version is set at build time with -ldflags "-X main.version=v1.2.3".
+// Without it, the module version recorded by go install is used.
+var version = "dev"
+
+// buildInfo returns the version to report and, when the go command embedded
+// them, the VCS revision, commit time and whether the tree was modified.
+func buildInfo() (ver, revision, date string, dirty bool) {
+	ver = version
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ver, "", "", false
+	}
+	if ver == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		ver = info.Main.Version
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.time":
+			date = s.Value
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	return ver, revision, date, dirty
+}
+
+func printVersion(w io.Writer) {
+	ver, revision, date, dirty := buildInfo()
+	fmt.Fprintf(w, "setmode %s (%s, %s/%s)\n", ver, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	if revision != "" {
+		if dirty {
+			revision += " (modified)"
+		}
+		fmt.Fprintf(w, "Commit %s", revision)
+		if date != "" {
+			fmt.Fprintf(w, ", %s", date)
+		}
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "Requires NinoTNC firmware v%d or later\n", ninotnc.MinFirmwareVersion)
+	for _, note := range ninotnc.FirmwareNotes() {
+		fmt.Fprintf(w, "  %s\n", note)
+	}
+}
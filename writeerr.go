@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// writeFailure says what happened to a connection that was open, since the
+// command is only sent once connecting succeeded, when a write to it failed:
+// it had already been closed, the far end closed it or reset it mid-write,
+// or the serial device went away, as when the USB cable is pulled. ok is
+// false for any other error, which is more likely a problem with the TNC or
+// the command itself.
+func writeFailure(err error) (what string, ok bool) {
+	switch {
+	case errors.Is(err, net.ErrClosed):
+		return "the connection had already been closed", true
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), isErrno(err, closedErrnos):
+		return "the TNC closed the connection", true
+	case isErrno(err, resetErrnos):
+		return "the connection was reset by the TNC or something in between", true
+	case isErrno(err, removedErrnos):
+		return "the serial device was removed; is the USB cable unplugged?", true
+	}
+	return "", false
+}
+
+// explainWrite adds writeFailure's description to a failed write.
+func explainWrite(err error) error {
+	if what, ok := writeFailure(err); ok {
+		return fmt.Errorf("%w (%s)", err, what)
+	}
+	return err
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+var (
+	closedErrnos = []error{syscall.EPIPE}
+	resetErrnos  = []error{syscall.ECONNRESET, syscall.ECONNABORTED}
+	// A USB serial adapter that disappears fails writes with one of these,
+	// depending on the driver and how far teardown has got.
+	removedErrnos = []error{syscall.ENODEV, syscall.ENXIO, syscall.EIO}
+)
@@ -0,0 +1,15 @@
+//go:build windows
+
+package main
+
+import "syscall"
+
+// As with dialing, Winsock and the serial driver report Windows error
+// numbers the syscall package has no names for. Winsock reports a write
+// after the far end closed the connection as a reset, so closedErrnos is
+// empty.
+var (
+	closedErrnos  []error
+	resetErrnos   = []error{syscall.Errno(10054), syscall.Errno(10053)} // WSAECONNRESET, WSAECONNABORTED
+	removedErrnos = []error{syscall.Errno(1167), syscall.Errno(31)}     // ERROR_DEVICE_NOT_CONNECTED, ERROR_GEN_FAILURE
+)